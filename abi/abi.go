@@ -1,6 +1,7 @@
 package abi
 
 import (
+	"bytes"
 	"math/big"
 
 	"github.com/holiman/uint256"
@@ -9,6 +10,18 @@ import (
 	"psm-monitor/net"
 )
 
+var (
+	coinsMethod    = MustMethod("coins(uint256)", "address")
+	symbolMethod   = MustMethod("symbol()", "string")
+	symbol32Method = MustMethod("symbol()", "bytes32")
+	decimalsMethod = MustMethod("decimals()", "uint8")
+)
+
+var (
+	BalancesMethod  = MustMethod("balances(uint256)", "uint256")
+	BalanceOfMethod = MustMethod("balanceOf(address)", "uint256")
+)
+
 func PadUint256(num uint64) string {
 	return hexutils.BytesToHex(uint256.NewInt(num).PaddedBytes(32))
 }
@@ -18,33 +31,59 @@ func PadAddress(addr string) string {
 }
 
 func Coins(addr string, i uint64) string {
-	result, err := net.Trigger(addr, "coins(uint256)", PadUint256(i))
+	values, err := coinsMethod.Call(addr, i)
 	if err != nil {
 		return ""
 	}
-	return misc.ToTronAddr(result[24:])
+	return values[0].(string)
 }
 
 func Name(addr string) string {
-	result, err := net.Trigger(addr, "symbol()", "")
+	result, err := net.Trigger(addr, symbolMethod.Sig, "")
 	if err != nil {
 		return ""
 	}
-	return string(hexutils.HexToBytes(result)[64:68])
+	if values, err := symbolMethod.Unpack(hexutils.HexToBytes(result)); err == nil {
+		return values[0].(string)
+	}
+	// some early tokens return symbol as bytes32
+	if values, err := symbol32Method.Unpack(hexutils.HexToBytes(result)); err == nil {
+		return string(bytes.TrimRight(values[0].([]byte), "\x00"))
+	}
+	misc.Warn("abi.Name", "action=\"decode symbol of "+addr+"\" reason=\"unknown return type\"")
+	return ""
 }
 
+// Decimals returns the decimals of the token, 18 if it cannot be queried
 func Decimals(addr string) uint8 {
-	result, err := net.Trigger(addr, "decimals()", "")
+	decimals, err := DecimalsOf(addr)
 	if err != nil {
 		return 18
 	}
-	return uint8(misc.ToBigInt(result).Uint64())
+	return decimals
+}
+
+// DecimalsOf is like Decimals but fails if the decimals cannot be queried
+func DecimalsOf(addr string) (uint8, error) {
+	decimals, err := decimalsMethod.CallBigInt(addr)
+	if err != nil {
+		return 0, err
+	}
+	return uint8(decimals.Uint64()), nil
 }
 
 func Balances(addr string, i int) (*big.Int, error) {
-	result, err := net.Trigger(addr, "balances(uint256)", hexutils.BytesToHex(uint256.NewInt(uint64(i)).PaddedBytes(32)))
+	balance, err := BalancesMethod.CallBigInt(addr, i)
+	if err != nil {
+		return big.NewInt(0), err
+	}
+	return balance, nil
+}
+
+func BalanceOf(token, owner string) (*big.Int, error) {
+	balance, err := BalanceOfMethod.CallBigInt(token, owner)
 	if err != nil {
 		return big.NewInt(0), err
 	}
-	return misc.ToBigInt(result), nil
+	return balance, nil
 }
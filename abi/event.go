@@ -0,0 +1,320 @@
+package abi
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/status-im/keycard-go/hexutils"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+)
+
+var ErrInvalidValue = errors.New("abi: invalid value")
+
+//go:embed contracts/*.json
+var contractsFS embed.FS
+
+var (
+	// events of all known contract ABIs, keyed by topic0, events of the same signature may differ
+	// in indexed inputs, like Mint of jTokens and SunSwap V2 pairs
+	events = make(map[common.Hash][]ethabi.Event)
+	// events of all known contract ABIs, keyed by event name, for typing rendered results
+	eventsByName = make(map[string][]ethabi.Event)
+)
+
+func init() {
+	entries, err := contractsFS.ReadDir("contracts")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := contractsFS.ReadFile("contracts/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		contract, err := ethabi.JSON(strings.NewReader(string(data)))
+		if err != nil {
+			panic(fmt.Sprintf("abi: invalid contract abi %s, %s", entry.Name(), err.Error()))
+		}
+		for _, event := range contract.Events {
+			if !containsEvent(events[event.ID], event) {
+				events[event.ID] = append(events[event.ID], event)
+				eventsByName[event.RawName] = append(eventsByName[event.RawName], event)
+			}
+		}
+	}
+}
+
+// EventSignature returns the hex encoded topic0 of the event signature, e.g. Transfer(address,address,uint256)
+func EventSignature(sig string) string {
+	return common.BytesToHash(crypto.Keccak256([]byte(sig))).Hex()
+}
+
+// EventTopics returns hex encoded topic0 of all known events
+func EventTopics() []string {
+	topics := make([]string, 0, len(events))
+	for id := range events {
+		topics = append(topics, id.Hex())
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// LogDecoder decodes raw logs with ABIs of all known contracts
+type LogDecoder struct{}
+
+func NewLogDecoder() *LogDecoder {
+	return &LogDecoder{}
+}
+
+func (d *LogDecoder) DecodeLog(log *net.Log, event *net.Event) error {
+	if len(log.Topics) == 0 {
+		return net.ErrUnknownEvent
+	}
+	candidates, ok := events[common.HexToHash(log.Topics[0])]
+	if !ok {
+		return net.ErrUnknownEvent
+	}
+	var err error
+	for _, abiEvent := range candidates {
+		var values map[string]interface{}
+		if values, err = unpackLog(abiEvent, log); err != nil {
+			continue
+		}
+		event.EventName = abiEvent.RawName
+		event.Event = strings.TrimPrefix(abiEvent.String(), "event ")
+		event.Result = make(map[string]string, len(values))
+		event.Values = make(map[string]interface{}, len(values))
+		for name, value := range values {
+			event.Result[name] = formatValue(value)
+			event.Values[name] = normalizeValue(value)
+		}
+		return nil
+	}
+	return err
+}
+
+// unpackLog decodes the log by the event, it fails if the indexed inputs do not match the topics
+func unpackLog(abiEvent ethabi.Event, log *net.Log) (map[string]interface{}, error) {
+	indexed := make(ethabi.Arguments, 0)
+	for _, input := range abiEvent.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(indexed) != len(log.Topics)-1 {
+		return nil, fmt.Errorf("abi: %s has %d indexed inputs, got %d topics", abiEvent.RawName, len(indexed), len(log.Topics)-1)
+	}
+	values := make(map[string]interface{})
+	if err := abiEvent.Inputs.UnpackIntoMap(values, hexutils.HexToBytes(strings.TrimPrefix(log.Data, "0x"))); err != nil {
+		return nil, err
+	}
+	topics := make([]common.Hash, 0, len(log.Topics)-1)
+	for _, topic := range log.Topics[1:] {
+		topics = append(topics, common.HexToHash(topic))
+	}
+	if err := ethabi.ParseTopicsIntoMap(values, indexed, topics); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DecodeResult types the rendered results of event server by the ABI of the event,
+// the types declared by event server are used if no known ABI matches
+func (d *LogDecoder) DecodeResult(event *net.Event) error {
+	types := make(map[string]ethabi.Type, len(event.Result))
+	if abiEvent, ok := matchEvent(event); ok {
+		for _, input := range abiEvent.Inputs {
+			types[input.Name] = input.Type
+		}
+	} else {
+		for name, typ := range event.ResultType {
+			if t, err := ethabi.NewType(typ, "", nil); err == nil {
+				types[name] = t
+			}
+		}
+	}
+	event.Values = make(map[string]interface{}, len(event.Result))
+	for name, text := range event.Result {
+		typ, ok := types[name]
+		if !ok {
+			continue
+		}
+		value, err := parseValue(typ, text)
+		if err != nil {
+			return fmt.Errorf("abi: parse %s of %s failed, %w", name, event.EventName, err)
+		}
+		event.Values[name] = value
+	}
+	return nil
+}
+
+func containsEvent(list []ethabi.Event, event ethabi.Event) bool {
+	for _, e := range list {
+		if e.String() == event.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEvent finds the known event with the same name and parameter names as the rendered event
+func matchEvent(event *net.Event) (ethabi.Event, bool) {
+	for _, abiEvent := range eventsByName[event.EventName] {
+		if len(abiEvent.Inputs) != len(event.Result) {
+			continue
+		}
+		matched := true
+		for _, input := range abiEvent.Inputs {
+			if _, ok := event.Result[input.Name]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return abiEvent, true
+		}
+	}
+	return ethabi.Event{}, false
+}
+
+// normalizeValue converts the decoded value to types used across the repo,
+// integers are *big.Int, addresses are base58 strings and fixed bytes are slices
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v
+	case common.Address:
+		return misc.ToTronAddr(v.Hex())
+	case []byte:
+		return v
+	case bool, string:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint())
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// fixed bytes like bytes32
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b
+		}
+		fallthrough
+	case reflect.Slice:
+		return normalizeElems(rv)
+	case reflect.Struct:
+		// tuples are decoded as anonymous structs
+		fields := make([]interface{}, rv.NumField())
+		for i := range fields {
+			fields[i] = normalizeValue(rv.Field(i).Interface())
+		}
+		return fields
+	}
+	return value
+}
+
+func normalizeElems(rv reflect.Value) interface{} {
+	elems := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elems[i] = normalizeValue(rv.Index(i).Interface())
+	}
+	// arrays of integers or addresses are the common cases, make them typed
+	ints, addrs := make([]*big.Int, len(elems)), make([]string, len(elems))
+	isInts, isAddrs := true, true
+	for i, elem := range elems {
+		ints[i], isInts = elem.(*big.Int)
+		if !isInts {
+			break
+		}
+	}
+	if isInts {
+		return ints
+	}
+	for i, elem := range elems {
+		addrs[i], isAddrs = elem.(string)
+		if !isAddrs {
+			break
+		}
+	}
+	if isAddrs {
+		return addrs
+	}
+	return elems
+}
+
+// parseValue parses the value rendered by event server, array elements are separated by newline
+func parseValue(typ ethabi.Type, text string) (interface{}, error) {
+	switch typ.T {
+	case ethabi.IntTy, ethabi.UintTy:
+		v, ok := new(big.Int).SetString(text, 0)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		return v, nil
+	case ethabi.AddressTy:
+		if strings.HasPrefix(text, "T") {
+			return text, nil
+		}
+		return misc.ToTronAddr(text), nil
+	case ethabi.BoolTy:
+		return text == "true", nil
+	case ethabi.StringTy:
+		return text, nil
+	case ethabi.BytesTy, ethabi.FixedBytesTy, ethabi.HashTy:
+		return hexutils.HexToBytes(strings.TrimPrefix(text, "0x")), nil
+	case ethabi.ArrayTy, ethabi.SliceTy:
+		parts := strings.Split(text, "\n")
+		if len(text) == 0 {
+			parts = nil
+		}
+		elems := make([]interface{}, len(parts))
+		for i, part := range parts {
+			elem, err := parseValue(*typ.Elem, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return normalizeElems(reflect.ValueOf(elems)), nil
+	}
+	return text, nil
+}
+
+// formatValue renders the decoded value the same way as TronGrid event server does,
+// array elements are separated by newline
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return strings.ToLower(v.Hex())
+	case common.Hash:
+		return strings.ToLower(hexutils.BytesToHex(v.Bytes()))
+	case []byte:
+		return strings.ToLower(hexutils.BytesToHex(v))
+	case [32]byte:
+		return strings.ToLower(hexutils.BytesToHex(v[:]))
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		elems := make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elems[i] = formatValue(rv.Index(i).Interface())
+		}
+		return strings.Join(elems, "\n")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,106 @@
+package abi
+
+import (
+	"math/big"
+	"testing"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/status-im/keycard-go/hexutils"
+	"psm-monitor/net"
+)
+
+func TestDecodeLog(t *testing.T) {
+	uint256, _ := ethabi.NewType("uint256", "", nil)
+	uint256s, _ := ethabi.NewType("uint256[2]", "", nil)
+	data, err := ethabi.Arguments{{Type: uint256s}, {Type: uint256s}, {Type: uint256}, {Type: uint256}}.Pack(
+		[2]*big.Int{big.NewInt(100), big.NewInt(200)}, [2]*big.Int{big.NewInt(1), big.NewInt(2)}, big.NewInt(3), big.NewInt(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &net.Log{
+		Address: "8a4c4e7f2e5bd6d0e4f5bb98a7c45f5c2e8a6c4d",
+		Topics: []string{
+			hexutils.BytesToHex(crypto.Keccak256([]byte("AddLiquidity(address,uint256[2],uint256[2],uint256,uint256)"))),
+			"000000000000000000000000a614f803b6fd780986a42c78ec9c7f77e6ded13c",
+		},
+		Data: hexutils.BytesToHex(data),
+	}
+	event := &net.Event{}
+	if err := NewLogDecoder().DecodeLog(log, event); err != nil {
+		t.Fatal(err)
+	}
+	if event.EventName != "AddLiquidity" || event.Result["token_amounts"] != "100\n200" ||
+		event.Result["provider"] != "0xa614f803b6fd780986a42c78ec9c7f77e6ded13c" || event.Result["token_supply"] != "4" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	if amounts := event.BigInts("token_amounts"); len(amounts) != 2 || amounts[1].Int64() != 200 ||
+		event.Addr("provider") != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" || event.BigInt("invariant").Int64() != 3 {
+		t.Fatalf("unexpected values %+v", event.Values)
+	}
+
+	log.Topics[0] = "00"
+	if err := NewLogDecoder().DecodeLog(log, event); err != net.ErrUnknownEvent {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDecodeResult(t *testing.T) {
+	event := &net.Event{
+		EventName: "TokenExchange",
+		Result: map[string]string{
+			"buyer":         "0xa614f803b6fd780986a42c78ec9c7f77e6ded13c",
+			"sold_id":       "1",
+			"tokens_sold":   "1000000",
+			"bought_id":     "0",
+			"tokens_bought": "999000000000000000",
+		},
+	}
+	if err := NewLogDecoder().DecodeResult(event); err != nil {
+		t.Fatal(err)
+	}
+	if event.BigInt("sold_id").Int64() != 1 || event.BigInt("tokens_bought").String() != "999000000000000000" ||
+		event.Addr("buyer") != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" {
+		t.Fatalf("unexpected values %+v", event.Values)
+	}
+
+	// unknown events are typed by the types declared by event server
+	event = &net.Event{
+		EventName:  "Unknown",
+		Result:     map[string]string{"amounts": "1\n2\n3"},
+		ResultType: map[string]string{"amounts": "uint256[]"},
+	}
+	if err := NewLogDecoder().DecodeResult(event); err != nil {
+		t.Fatal(err)
+	}
+	if amounts := event.BigInts("amounts"); len(amounts) != 3 || amounts[2].Int64() != 3 {
+		t.Fatalf("unexpected values %+v", event.Values)
+	}
+}
+
+func TestDecodeLogSameSignature(t *testing.T) {
+	uint256, _ := ethabi.NewType("uint256", "", nil)
+	topic0 := hexutils.BytesToHex(crypto.Keccak256([]byte("Mint(address,uint256,uint256)")))
+	sender := "000000000000000000000000a614f803b6fd780986a42c78ec9c7f77e6ded13c"
+
+	// SunSwap V2 pair, sender is indexed
+	data, _ := ethabi.Arguments{{Type: uint256}, {Type: uint256}}.Pack(big.NewInt(1), big.NewInt(2))
+	event := &net.Event{}
+	if err := NewLogDecoder().DecodeLog(&net.Log{Topics: []string{topic0, sender}, Data: hexutils.BytesToHex(data)}, event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Addr("sender") != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" || event.BigInt("amount1").Int64() != 2 {
+		t.Fatalf("unexpected values %+v", event.Values)
+	}
+
+	// jToken, minter is not indexed
+	data, _ = ethabi.Arguments{{Type: uint256}, {Type: uint256}, {Type: uint256}}.Pack(big.NewInt(0), big.NewInt(3), big.NewInt(4))
+	event = &net.Event{}
+	if err := NewLogDecoder().DecodeLog(&net.Log{Topics: []string{topic0}, Data: hexutils.BytesToHex(data)}, event); err != nil {
+		t.Fatal(err)
+	}
+	if event.BigInt("mintAmount").Int64() != 3 || event.BigInt("mintTokens").Int64() != 4 {
+		t.Fatalf("unexpected values %+v", event.Values)
+	}
+}
@@ -0,0 +1,284 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/status-im/keycard-go/hexutils"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+)
+
+// Method is a contract function with typed inputs and outputs, e.g.
+// NewMethod("get_dy(int128,int128,uint256)", "uint256") or NewMethod("getAccountSnapshot(address)", "uint256", "uint256", "uint256", "uint256")
+type Method struct {
+	Sig     string
+	Name    string
+	Inputs  ethabi.Arguments
+	Outputs ethabi.Arguments
+}
+
+// NewMethod parses the function signature and output types, tuples are written as (type1,type2)
+func NewMethod(sig string, outputs ...string) (*Method, error) {
+	sig = strings.ReplaceAll(sig, " ", "")
+	open := strings.Index(sig, "(")
+	if open <= 0 || !strings.HasSuffix(sig, ")") {
+		return nil, fmt.Errorf("abi: invalid function signature %s", sig)
+	}
+	inputs, err := parseArguments(splitTypes(sig[open+1 : len(sig)-1]))
+	if err != nil {
+		return nil, err
+	}
+	outputArgs, err := parseArguments(outputs)
+	if err != nil {
+		return nil, err
+	}
+	return &Method{Sig: sig, Name: sig[:open], Inputs: inputs, Outputs: outputArgs}, nil
+}
+
+// MustMethod is like NewMethod but panics on invalid signature, for package level methods
+func MustMethod(sig string, outputs ...string) *Method {
+	m, err := NewMethod(sig, outputs...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Selector returns the first four bytes of the keccak hash of the signature
+func (m *Method) Selector() []byte {
+	return crypto.Keccak256([]byte(m.Sig))[:4]
+}
+
+// Pack encodes the arguments, integers can be any Go integer or *big.Int, addresses can be base58 or hex,
+// bytes can be hex strings, arrays are slices and tuples are []interface{}
+func (m *Method) Pack(args ...interface{}) ([]byte, error) {
+	if len(args) != len(m.Inputs) {
+		return nil, fmt.Errorf("abi: %s requires %d arguments, got %d", m.Sig, len(m.Inputs), len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		value, err := toPackable(m.Inputs[i].Type, arg)
+		if err != nil {
+			return nil, fmt.Errorf("abi: argument %d of %s, %w", i, m.Sig, err)
+		}
+		values[i] = value.Interface()
+	}
+	return m.Inputs.Pack(values...)
+}
+
+// Unpack decodes the return data into values of types used across the repo, see normalizeValue
+func (m *Method) Unpack(data []byte) ([]interface{}, error) {
+	values, err := m.Outputs.UnpackValues(data)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = normalizeValue(values[i])
+	}
+	return values, nil
+}
+
+// Call triggers the constant method of the contract and decodes its return values
+func (m *Method) Call(addr string, args ...interface{}) ([]interface{}, error) {
+	data, err := m.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := net.Trigger(addr, m.Sig, hexutils.BytesToHex(data))
+	if err != nil {
+		return nil, err
+	}
+	return m.Unpack(hexutils.HexToBytes(result))
+}
+
+// CallAt calls the constant method at the given block via json rpc, zero block number means the latest block
+func (m *Method) CallAt(addr string, blockNumber uint64, args ...interface{}) ([]interface{}, error) {
+	data, err := m.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := net.EthCall(addr, append(m.Selector(), data...), blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return m.Unpack(result)
+}
+
+// CallBigInt calls the method which returns a single integer
+func (m *Method) CallBigInt(addr string, args ...interface{}) (*big.Int, error) {
+	values, err := m.Call(addr, args...)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := values[0].(*big.Int); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("abi: %s returns %T, not integer", m.Sig, values[0])
+}
+
+// splitTypes splits comma separated types at top level, commas inside tuples are kept
+func splitTypes(s string) []string {
+	types := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if len(s) > 0 {
+		types = append(types, s[start:])
+	}
+	return types
+}
+
+func parseArguments(types []string) (ethabi.Arguments, error) {
+	args := make(ethabi.Arguments, len(types))
+	for i, t := range types {
+		marshaling := toMarshaling(strings.TrimSpace(t), fmt.Sprintf("f%d", i))
+		typ, err := ethabi.NewType(marshaling.Type, "", marshaling.Components)
+		if err != nil {
+			return nil, fmt.Errorf("abi: invalid type %s, %w", t, err)
+		}
+		args[i] = ethabi.Argument{Name: marshaling.Name, Type: typ}
+	}
+	return args, nil
+}
+
+// toMarshaling converts the type written in signature form, like (address,bytes)[], to the json form of ABI
+func toMarshaling(t, name string) ethabi.ArgumentMarshaling {
+	if !strings.HasPrefix(t, "(") {
+		return ethabi.ArgumentMarshaling{Name: name, Type: t}
+	}
+	closing := strings.LastIndex(t, ")")
+	components := make([]ethabi.ArgumentMarshaling, 0)
+	for i, c := range splitTypes(t[1:closing]) {
+		components = append(components, toMarshaling(c, fmt.Sprintf("f%d", i)))
+	}
+	return ethabi.ArgumentMarshaling{Name: name, Type: "tuple" + t[closing+1:], Components: components}
+}
+
+// toPackable converts the Go argument to the exact Go type required by the ABI packer
+func toPackable(typ ethabi.Type, arg interface{}) (reflect.Value, error) {
+	goType := typ.GetType()
+	switch typ.T {
+	case ethabi.IntTy, ethabi.UintTy:
+		n, err := toBigInt(arg)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if goType == reflect.TypeOf(&big.Int{}) {
+			return reflect.ValueOf(n), nil
+		}
+		if typ.T == ethabi.IntTy {
+			return reflect.ValueOf(n.Int64()).Convert(goType), nil
+		}
+		return reflect.ValueOf(n.Uint64()).Convert(goType), nil
+	case ethabi.AddressTy:
+		switch v := arg.(type) {
+		case common.Address:
+			return reflect.ValueOf(v), nil
+		case string:
+			if strings.HasPrefix(v, "T") {
+				v = misc.ToEthAddr(v)
+			}
+			return reflect.ValueOf(common.HexToAddress(v)), nil
+		}
+	case ethabi.BoolTy:
+		if v, ok := arg.(bool); ok {
+			return reflect.ValueOf(v), nil
+		}
+	case ethabi.StringTy:
+		if v, ok := arg.(string); ok {
+			return reflect.ValueOf(v), nil
+		}
+	case ethabi.BytesTy, ethabi.FixedBytesTy:
+		var b []byte
+		switch v := arg.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = hexutils.HexToBytes(strings.TrimPrefix(v, "0x"))
+		default:
+			return reflect.Value{}, fmt.Errorf("cannot use %T as %s", arg, typ.String())
+		}
+		if typ.T == ethabi.BytesTy {
+			return reflect.ValueOf(b), nil
+		}
+		if len(b) > typ.Size {
+			return reflect.Value{}, fmt.Errorf("%d bytes exceed %s", len(b), typ.String())
+		}
+		fixed := reflect.New(goType).Elem()
+		reflect.Copy(fixed, reflect.ValueOf(b))
+		return fixed, nil
+	case ethabi.SliceTy, ethabi.ArrayTy:
+		rv := reflect.ValueOf(arg)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		var list reflect.Value
+		if typ.T == ethabi.SliceTy {
+			list = reflect.MakeSlice(goType, rv.Len(), rv.Len())
+		} else if rv.Len() == typ.Size {
+			list = reflect.New(goType).Elem()
+		} else {
+			return reflect.Value{}, fmt.Errorf("%d elements for %s", rv.Len(), typ.String())
+		}
+		for i := 0; i < rv.Len(); i++ {
+			elem, err := toPackable(*typ.Elem, rv.Index(i).Interface())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			list.Index(i).Set(elem)
+		}
+		return list, nil
+	case ethabi.TupleTy:
+		fields, ok := arg.([]interface{})
+		if !ok || len(fields) != len(typ.TupleElems) {
+			break
+		}
+		tuple := reflect.New(goType).Elem()
+		for i, field := range fields {
+			elem, err := toPackable(*typ.TupleElems[i], field)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			tuple.Field(i).Set(elem)
+		}
+		return tuple, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as %s", arg, typ.String())
+}
+
+func toBigInt(arg interface{}) (*big.Int, error) {
+	switch v := arg.(type) {
+	case *big.Int:
+		return v, nil
+	case string:
+		if n, ok := new(big.Int).SetString(v, 0); ok {
+			return n, nil
+		}
+	default:
+		rv := reflect.ValueOf(arg)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return big.NewInt(rv.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return new(big.Int).SetUint64(rv.Uint()), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot use %T as integer", arg)
+}
@@ -0,0 +1,72 @@
+package abi
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/status-im/keycard-go/hexutils"
+)
+
+func TestMethodPack(t *testing.T) {
+	m := MustMethod("get_dy(int128,int128,uint256)", "uint256")
+	data, err := m.Pack(0, 1, big.NewInt(1_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0000000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"00000000000000000000000000000000000000000000000000000000000F4240"
+	if hexutils.BytesToHex(data) != want {
+		t.Fatalf("unexpected data %s", hexutils.BytesToHex(data))
+	}
+	if hexutils.BytesToHex(m.Selector()) != "5E0D443F" {
+		t.Fatalf("unexpected selector %x", m.Selector())
+	}
+
+	m = MustMethod("getAccountSnapshot(address)", "uint256", "uint256", "uint256", "uint256")
+	data, err = m.Pack("TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hexutils.BytesToHex(data) != "000000000000000000000000A614F803B6FD780986A42C78EC9C7F77E6DED13C" {
+		t.Fatalf("unexpected data %s", hexutils.BytesToHex(data))
+	}
+	if _, err := m.Pack(); err == nil {
+		t.Fatal("missing argument should fail")
+	}
+}
+
+func TestMethodTuple(t *testing.T) {
+	m := MustMethod("tryAggregate(bool,(address,bytes)[])", "(bool,bytes)[]")
+	if _, err := m.Pack(false, []interface{}{
+		[]interface{}{"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", "313ce567"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := m.Outputs.Pack([]struct {
+		F0 bool
+		F1 []byte
+	}{{true, []byte{1, 2}}, {false, nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := m.Unpack(ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{[]interface{}{[]interface{}{true, []byte{1, 2}}, []interface{}{false, []byte{}}}}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("unexpected values %#v", values)
+	}
+}
+
+func TestMethodUnpackString(t *testing.T) {
+	m := MustMethod("symbol()", "string")
+	ret, _ := m.Outputs.Pack("USDCOIN")
+	values, err := m.Unpack(ret)
+	if err != nil || values[0] != "USDCOIN" {
+		t.Fatalf("unexpected values %v, err %v", values, err)
+	}
+}
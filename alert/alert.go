@@ -0,0 +1,190 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"psm-monitor/config"
+	"psm-monitor/misc"
+	"psm-monitor/notify"
+)
+
+// state is the condition of an alert key
+type state struct {
+	active bool
+	// sentAt is the last time the alert of the key is sent
+	sentAt time.Time
+	// severity of the alert, the resolved message is sent with it so that it reaches the channels of the alert
+	severity Severity
+}
+
+// manager sits between monitors and notify, it drops identical alerts within the dedup window,
+// repeats alerts of a persisting condition only after the cooldown, and drops muted alerts
+type manager struct {
+	lock   sync.Mutex
+	states map[string]*state
+	// sent are times of recently sent alerts, keyed by topic and text
+	sent map[string]time.Time
+
+	send func(topic string, severity notify.Severity, text string)
+	now  func() time.Time
+}
+
+func newManager(send func(topic string, severity notify.Severity, text string)) *manager {
+	return &manager{states: make(map[string]*state), sent: make(map[string]time.Time), send: send, now: time.Now}
+}
+
+var defaultManager = newManager(func(topic string, severity notify.Severity, text string) {
+	_ = notify.Send(&notify.Message{Topic: topic, Severity: severity, Text: text})
+})
+
+type Severity = notify.Severity
+
+const (
+	Info     = notify.Info
+	Warning  = notify.Warning
+	Critical = notify.Critical
+)
+
+// Send sends the alert unless an identical one was sent within the dedup window or the monitor is muted,
+// it suits alerts of events which have no condition to resolve
+func Send(topic string, severity Severity, format string, a ...any) {
+	defaultManager.notify(config.Get().Alert, topic, "", severity, sprintf(format, a...))
+}
+
+// Fire sends the alert of a condition identified by key, like "gem_balance.USDT", while the condition persists
+// the alert is repeated only after the cooldown of the key, it returns whether the alert is sent
+func Fire(topic, key string, severity Severity, format string, a ...any) bool {
+	return defaultManager.fire(config.Get().Alert, topic, key, severity, sprintf(format, a...))
+}
+
+// Resolve sends the resolved message with the severity of the alert if the condition of key has been fired,
+// so that it reaches the channels the alert went to, otherwise it does nothing
+func Resolve(topic, key, format string, a ...any) bool {
+	return defaultManager.resolve(config.Get().Alert, topic, key, sprintf(format, a...))
+}
+
+func sprintf(format string, a ...any) string {
+	if len(a) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, a...)
+}
+
+func (m *manager) notify(conf config.AlertConfig, topic, key string, severity Severity, text string) bool {
+	m.lock.Lock()
+	admitted := m.admitLocked(conf, topic, key, text)
+	m.lock.Unlock()
+	if admitted {
+		m.send(topic, severity, text)
+	}
+	return admitted
+}
+
+func (m *manager) fire(conf config.AlertConfig, topic, key string, severity Severity, text string) bool {
+	if !m.admitFire(conf, topic, key, severity, text) {
+		return false
+	}
+	m.send(topic, severity, text)
+	return true
+}
+
+func (m *manager) admitFire(conf config.AlertConfig, topic, key string, severity Severity, text string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	fullKey := keyOf(topic, key)
+	s, ok := m.states[fullKey]
+	if !ok {
+		s = &state{}
+		m.states[fullKey] = s
+	}
+	if cooldown := cooldownOf(conf, fullKey); s.active && m.now().Sub(s.sentAt) < cooldown {
+		misc.Debug("alert.Fire", fmt.Sprintf("key=%s reason=\"in cooldown\"", fullKey))
+		return false
+	}
+	s.active, s.severity = true, severity
+	if !m.admitLocked(conf, topic, key, text) {
+		return false
+	}
+	s.sentAt = m.now()
+	return true
+}
+
+func (m *manager) resolve(conf config.AlertConfig, topic, key, text string) bool {
+	text = ":white_check_mark: " + text
+	m.lock.Lock()
+	s, ok := m.states[keyOf(topic, key)]
+	admitted, severity := ok && s.active, Info
+	if admitted {
+		s.active, severity = false, s.severity
+		admitted = m.admitLocked(conf, topic, key, text)
+	}
+	m.lock.Unlock()
+	if admitted {
+		m.send(topic, severity, text)
+	}
+	return admitted
+}
+
+// admitLocked tells whether the text is to be sent, i.e. neither muted nor duplicated, the lock must be held,
+// the text is sent by the caller after releasing the lock so that a slow channel does not block other alerts
+func (m *manager) admitLocked(conf config.AlertConfig, topic, key string, text string) bool {
+	now := m.now()
+	if muted(conf, topic, key, now) {
+		misc.Info("alert muted", fmt.Sprintf("topic=\"%s\" key=%s content=\"%s\"", topic, key, text))
+		return false
+	}
+	window := time.Duration(conf.DedupWindow) * time.Second
+	for k, sentAt := range m.sent {
+		if now.Sub(sentAt) >= window {
+			delete(m.sent, k)
+		}
+	}
+	dedupKey := topic + "\n" + text
+	if _, ok := m.sent[dedupKey]; ok {
+		misc.Debug("alert deduplicated", fmt.Sprintf("topic=\"%s\" key=%s content=\"%s\"", topic, key, text))
+		return false
+	}
+	if window > 0 {
+		m.sent[dedupKey] = now
+	}
+	return true
+}
+
+// cooldownOf returns the cooldown of the key, overridden by the longest matched key like PSM.debt of PSM.debt.USDT
+func cooldownOf(conf config.AlertConfig, fullKey string) time.Duration {
+	cooldown, matched := conf.Cooldown, ""
+	for k, v := range conf.Cooldowns {
+		if (fullKey == k || strings.HasPrefix(fullKey, k+".")) && len(k) > len(matched) {
+			cooldown, matched = v, k
+		}
+	}
+	return time.Duration(cooldown) * time.Second
+}
+
+func keyOf(topic, key string) string {
+	return notify.MonitorOf(topic) + "." + key
+}
+
+func muted(conf config.AlertConfig, topic, key string, now time.Time) bool {
+	monitor := notify.MonitorOf(topic)
+	for _, mute := range conf.Mutes {
+		if !strings.EqualFold(mute.Monitor, monitor) || !strings.HasPrefix(key, mute.Key) {
+			continue
+		}
+		if len(mute.Until) == 0 {
+			return true
+		}
+		until, err := time.ParseInLocation("2006-01-02 15:04", mute.Until, time.Local)
+		if err != nil {
+			misc.Warn("alert.muted", fmt.Sprintf("until=\"%s\" reason=\"%s\"", mute.Until, err.Error()))
+			continue
+		}
+		if now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"psm-monitor/config"
+	"psm-monitor/notify"
+)
+
+func TestFireAndResolve(t *testing.T) {
+	sent := make([]string, 0)
+	m := newManager(func(topic string, severity notify.Severity, text string) { sent = append(sent, text) })
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	m.now = func() time.Time { return now }
+	conf := config.AlertConfig{DedupWindow: 600, Cooldown: 3600, Cooldowns: map[string]int64{"PSM.debt": 60}}
+
+	if !m.fire(conf, ":usdd: [PSM]", "gem_balance.USDT", Warning, "large change 1") {
+		t.Fatal("first alert should be sent")
+	}
+	now = now.Add(10 * time.Minute)
+	if m.fire(conf, ":usdd: [PSM]", "gem_balance.USDT", Warning, "large change 2") {
+		t.Fatal("alert in cooldown should not be sent")
+	}
+	if !m.resolve(conf, ":usdd: [PSM]", "gem_balance.USDT", "settled") {
+		t.Fatal("resolved message should be sent")
+	}
+	if m.resolve(conf, ":usdd: [PSM]", "gem_balance.USDT", "settled again") {
+		t.Fatal("inactive condition should not be resolved")
+	}
+	if !m.fire(conf, ":usdd: [PSM]", "gem_balance.USDT", Warning, "large change 3") {
+		t.Fatal("alert after resolved should be sent")
+	}
+
+	// the cooldown of keys under PSM.debt is overridden
+	m.fire(conf, ":usdd: [PSM]", "debt.USDT", Warning, "debt high 1")
+	now = now.Add(2 * time.Minute)
+	if !m.fire(conf, ":usdd: [PSM]", "debt.USDT", Warning, "debt high 2") {
+		t.Fatal("alert after its cooldown should be sent")
+	}
+
+	want := []string{"large change 1", ":white_check_mark: settled", "large change 3", "debt high 1", "debt high 2"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent %v, want %v", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent %v, want %v", sent, want)
+		}
+	}
+}
+
+func TestDedupAndMute(t *testing.T) {
+	count := 0
+	m := newManager(func(topic string, severity notify.Severity, text string) { count++ })
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	m.now = func() time.Time { return now }
+	conf := config.AlertConfig{DedupWindow: 600, Mutes: []config.MuteConfig{
+		{Monitor: "SUN", Key: "depeg"},
+		{Monitor: "JST", Until: "2024-01-01 01:00"},
+	}}
+
+	m.notify(conf, ":sunio: [SUN]", "", Warning, "large swap")
+	m.notify(conf, ":sunio: [SUN]", "", Warning, "large swap")
+	if count != 1 {
+		t.Fatalf("identical alerts within window sent %d times", count)
+	}
+	now = now.Add(10 * time.Minute)
+	m.notify(conf, ":sunio: [SUN]", "", Warning, "large swap")
+	if count != 2 {
+		t.Fatal("identical alert after window should be sent")
+	}
+
+	if m.fire(conf, ":sunio: [SUN]", "depeg.USDD-2pool.USDD", Critical, "depeg") {
+		t.Fatal("muted key should not be sent")
+	}
+	if m.notify(conf, ":jst: [JST]", "", Warning, "large borrow") {
+		t.Fatal("muted monitor should not be sent before until")
+	}
+	now = now.Add(time.Hour)
+	if !m.notify(conf, ":jst: [JST]", "", Warning, "large borrow") {
+		t.Fatal("mute should end at until")
+	}
+}
+
+func TestSendWithoutLock(t *testing.T) {
+	var m *manager
+	m = newManager(func(topic string, severity notify.Severity, text string) {
+		if !m.lock.TryLock() {
+			t.Fatal("alert should be sent without holding the lock")
+		}
+		m.lock.Unlock()
+	})
+	conf := config.AlertConfig{}
+	m.notify(conf, ":usdd: [PSM]", "", Warning, "large change")
+	m.fire(conf, ":usdd: [PSM]", "debt.USDT", Warning, "debt high")
+	m.resolve(conf, ":usdd: [PSM]", "debt.USDT", "debt normal")
+}
+
+func TestResolveWithFiredSeverity(t *testing.T) {
+	severities := make([]notify.Severity, 0)
+	m := newManager(func(topic string, severity notify.Severity, text string) { severities = append(severities, severity) })
+	conf := config.AlertConfig{}
+	m.fire(conf, ":sunio: [SUN]", "depeg.USDD-2pool.USDD", Critical, "depeg")
+	m.resolve(conf, ":sunio: [SUN]", "depeg.USDD-2pool.USDD", "trades back")
+	if len(severities) != 2 || severities[1] != Critical {
+		t.Fatalf("sent with severities %v, want resolved as critical", severities)
+	}
+}
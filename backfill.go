@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"psm-monitor/config"
+	"psm-monitor/metrics"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+	"psm-monitor/notify"
+)
+
+// fetchedBlock is a block fetched by the backfill workers, waiting to be tracked in order
+type fetchedBlock struct {
+	number uint64
+	block  *net.Block
+	events []*net.Event
+	err    error
+}
+
+var (
+	lagGauge       = metrics.GetGauge("track.lag")
+	fetchedCounter = metrics.GetCounter("track.fetched_blocks")
+	isLagWarned    bool
+)
+
+// backfill fetches blocks in [from, to] concurrently and tracks them strictly in block order,
+// it returns false if some block cannot be tracked for now
+func backfill(from, to uint64) bool {
+	fetched := fetchBlocks(from, to)
+	for _, f := range fetched {
+		if f.err != nil {
+			misc.Warn("Track task report", fmt.Sprintf("block %d cannot be fetched, reason=\"%s\"", f.number, f.err.Error()))
+			return false
+		}
+		if !trackBlock(f) {
+			return false
+		}
+		if trackedBlockNumber != f.number {
+			// the chain is rolled back, blocks fetched after this one are stale
+			return true
+		}
+	}
+	return true
+}
+
+// fetchBlocks fetches blocks in [from, to] with bounded concurrency and rate, results are in block order
+func fetchBlocks(from, to uint64) []*fetchedBlock {
+	concurrency := config.Get().Track.BackfillConcurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	var limiter <-chan time.Time
+	if rate := config.Get().Track.BackfillRate; rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	fetched := make([]*fetchedBlock, to-from+1)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := uint64(0); w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fetched[i] = fetchBlock(from + uint64(i))
+			}
+		}()
+	}
+	for i := range fetched {
+		if limiter != nil {
+			<-limiter
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return fetched
+}
+
+func fetchBlock(blockNumber uint64) *fetchedBlock {
+	f := &fetchedBlock{number: blockNumber}
+	if f.block, f.err = net.GetBlock(blockNumber); f.err != nil {
+		return f
+	}
+	if f.events, f.err = net.GetBlockEvents(f.block); f.err != nil {
+		return f
+	}
+	fetchedCounter.Inc(1)
+	return f
+}
+
+// reportLag records how far the tracker falls behind the chain head, and warns once it exceeds the threshold
+func reportLag(latestBlockNumber uint64) {
+	var lag uint64
+	if latestBlockNumber > trackedBlockNumber {
+		lag = latestBlockNumber - trackedBlockNumber
+	}
+	lagGauge.Set(int64(lag))
+	threshold := config.Get().Track.LagThreshold
+	if threshold == 0 {
+		return
+	}
+	if !isLagWarned && lag > threshold {
+		isLagWarned = true
+		notify.SendMsg(":zany_face: [APP]", notify.Warning, "Tracker falls behind, lag - `%d` blocks, tracked - `%d`, latest - `%d`",
+			lag, trackedBlockNumber, latestBlockNumber)
+	}
+	if isLagWarned && lag <= threshold {
+		isLagWarned = false
+		// sent as warning like the lag, so that it reaches the channels the lag went to
+		notify.SendMsg(":zany_face: [APP]", notify.Warning, "Tracker caught up, lag - `%d` blocks", lag)
+	}
+}
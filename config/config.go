@@ -12,26 +12,213 @@ type Config struct {
 	LogLevel        string `toml:"log_level"`
 	FullNode        string `toml:"full_node"`
 	EventServer     string `toml:"event_server"`
+	EventSource     string `toml:"event_source"`
+	Multicall       string `toml:"multicall"`
+	Track           TrackConfig
+	Alert           AlertConfig
+	Notify          NotifyConfig
+	Price           PriceConfig
 	SUN             SUNConfig
+	SunSwap         SunSwapConfig
 	PSM             PSMConfig
 	JST             JSTConfig
 }
 
+type TrackConfig struct {
+	// MaxCatchUp is the max number of blocks replayed from the stored cursor after a restart
+	MaxCatchUp uint64 `toml:"max_catch_up"`
+	// ReorgWindow is the number of recent block hashes remembered for detecting chain reorganization
+	ReorgWindow uint64 `toml:"reorg_window"`
+	// BackfillConcurrency is the number of workers fetching missed blocks in parallel
+	BackfillConcurrency uint64 `toml:"backfill_concurrency"`
+	// BackfillRate is the max number of blocks fetched per second, zero means unlimited
+	BackfillRate uint64 `toml:"backfill_rate"`
+	// LagThreshold is the number of blocks behind the chain head that triggers a warning
+	LagThreshold uint64 `toml:"lag_threshold"`
+}
+
+type AlertConfig struct {
+	// DedupWindow is the number of seconds identical alerts of a monitor are sent only once
+	DedupWindow int64 `toml:"dedup_window"`
+	// Cooldown is the number of seconds an alert of the same key is not repeated while its condition persists
+	Cooldown int64 `toml:"cooldown"`
+	// Cooldowns override Cooldown of alert keys like "PSM.gem_balance"
+	Cooldowns map[string]int64 `toml:"cooldowns"`
+	Mutes     []MuteConfig     `toml:"mutes"`
+}
+
+type MuteConfig struct {
+	// Monitor is the name in the topic like PSM, Key is the prefix of muted alert keys, empty means all
+	Monitor string `toml:"monitor"`
+	Key     string `toml:"key"`
+	// Until is the local time like 2006-01-02 15:04 the mute ends at, empty means until removed
+	Until string `toml:"until"`
+}
+
+type NotifyConfig struct {
+	// DefaultChannels receive messages matching no route, slack if empty
+	DefaultChannels []string `toml:"default_channels"`
+	// CriticalMentions are ids of slack user groups mentioned by critical messages in slack channels
+	CriticalMentions []string        `toml:"critical_mentions"`
+	Channels         []ChannelConfig `toml:"channels"`
+	Routes           []RouteConfig   `toml:"routes"`
+}
+
+// ChannelConfig is a notification backend, channels named slack and fee are implied by the webhooks above
+type ChannelConfig struct {
+	Name string `toml:"name"`
+	// Type is one of slack, telegram, discord, webhook and smtp
+	Type string `toml:"type"`
+	// URL is the webhook of slack, discord and webhook channels
+	URL string `toml:"url"`
+	// Token and ChatID of the telegram bot
+	Token  string `toml:"token"`
+	ChatID string `toml:"chat_id"`
+	// smtp server and mail addresses
+	Host     string   `toml:"host"`
+	Port     int      `toml:"port"`
+	Username string   `toml:"username"`
+	Password string   `toml:"password"`
+	From     string   `toml:"from"`
+	To       []string `toml:"to"`
+}
+
+// RouteConfig sends messages of the monitors and severities to the channels, empty lists match all,
+// a message goes to channels of the first matched route
+type RouteConfig struct {
+	Monitors   []string `toml:"monitors"`
+	Severities []string `toml:"severities"`
+	Channels   []string `toml:"channels"`
+}
+
+type PriceConfig struct {
+	// Sources are names of price sources in the order they are tried
+	Sources []string `toml:"sources"`
+	// TTL is the number of seconds a quote is cached
+	TTL int64 `toml:"ttl"`
+	// MaxAge is the number of seconds a cached quote is still used if all sources fail
+	MaxAge int64 `toml:"max_age"`
+	// Stablecoins are valued at 1 USD if they have no price, other tokens without price are not valued
+	Stablecoins []string `toml:"stablecoins"`
+}
+
 type SUNConfig struct {
+	Confirmations      uint64 `toml:"confirmations"`
+	SwapThreshold      int64  `toml:"swap_threshold"`
+	LiquidityThreshold int64  `toml:"liquidity_threshold"`
+	ReportThreshold    int64  `toml:"report_threshold"`
+	// CriticalTokens are tokens whose removal from pools is critical, like USDT
+	CriticalTokens []string `toml:"critical_tokens"`
+	Depeg          DepegConfig
+	Pools          []PoolConfig `toml:"pools"`
+}
+
+type PoolConfig struct {
+	Name    string `toml:"name"`
+	Address string `toml:"address"`
+	Coins   int    `toml:"coins"`
+	// BasePool is the base pool of a meta pool, whose coins are the underlying coins besides coin0 of the meta pool
+	BasePool string `toml:"base_pool"`
+	// thresholds of the pool, zero means the threshold of SUN
 	SwapThreshold      int64 `toml:"swap_threshold"`
 	LiquidityThreshold int64 `toml:"liquidity_threshold"`
 	ReportThreshold    int64 `toml:"report_threshold"`
 }
 
+type DepegConfig struct {
+	// TradeSize is the readable amount of coin quoted via get_dy in both directions
+	TradeSize int64 `toml:"trade_size"`
+	// coins trading outside [Lower, Upper] of the other coin are alerted
+	Lower float64 `toml:"lower"`
+	Upper float64 `toml:"upper"`
+	// Retention is the number of days price records are kept
+	Retention int `toml:"retention"`
+}
+
+type SunSwapConfig struct {
+	Confirmations      uint64 `toml:"confirmations"`
+	SwapThreshold      int64  `toml:"swap_threshold"`
+	LiquidityThreshold int64  `toml:"liquidity_threshold"`
+	ReportThreshold    int64  `toml:"report_threshold"`
+	// PriceImpact is the percent of price move by a single swap or within a check interval that is alerted
+	PriceImpact float64      `toml:"price_impact"`
+	Pairs       []PairConfig `toml:"pairs"`
+}
+
+type PairConfig struct {
+	Name    string `toml:"name"`
+	Address string `toml:"address"`
+	// Version is 2 for SunSwap V2 pairs and 3 for SunSwap V3 pools
+	Version int `toml:"version"`
+}
+
 type PSMConfig struct {
+	Confirmations   uint64 `toml:"confirmations"`
+	GemThreshold    int64  `toml:"gem_threshold"`
+	DaiThreshold    int64  `toml:"dai_threshold"`
+	ReportThreshold int64  `toml:"report_threshold"`
+	// DebtPercent is the percent of the debt ceiling of an ilk above which its debt is alerted
+	DebtPercent float64 `toml:"debt_percent"`
+	Flow        FlowConfig
+	Ilks        []IlkConfig `toml:"ilks"`
+}
+
+type FlowConfig struct {
+	// TopN is the number of addresses by volume shown in stats and daily summary
+	TopN int `toml:"top_n"`
+	// DailySummary is the local time like 09:00 the daily summary is posted at, applied at startup
+	DailySummary string `toml:"daily_summary"`
+}
+
+type IlkConfig struct {
+	// Name is the symbol of the gem, the symbol of the token is used if empty
+	Name    string `toml:"name"`
+	Token   string `toml:"token"`
+	GemJoin string `toml:"gem_join"`
+	PSM     string `toml:"psm"`
+	// thresholds of the ilk, zero means the threshold of PSM
 	GemThreshold    int64 `toml:"gem_threshold"`
-	DaiThreshold    int64 `toml:"dai_threshold"`
 	ReportThreshold int64 `toml:"report_threshold"`
 }
 
 type JSTConfig struct {
-	StableThreshold int64 `toml:"stable_threshold"`
-	ReportThreshold int64 `toml:"report_threshold"`
+	Confirmations uint64 `toml:"confirmations"`
+	// events of a market moving at least such USD value are alerted, usd_thresholds overrides it per market symbol
+	USDThreshold  float64            `toml:"usd_threshold"`
+	USDThresholds map[string]float64 `toml:"usd_thresholds"`
+	// StableThreshold is the former name of usd_threshold, used if usd_threshold is not set
+	StableThreshold float64           `toml:"stable_threshold"`
+	ReportThreshold int64             `toml:"report_threshold"`
+	Liquidation     LiquidationConfig `toml:"liquidation"`
+	Utilization     UtilizationConfig `toml:"utilization"`
+	Watchlist       WatchlistConfig   `toml:"watchlist"`
+}
+
+type UtilizationConfig struct {
+	// symbols of markets to be checked, like USDT
+	Markets []string `toml:"markets"`
+	// utilization levels to be alerted in ascending order, like 0.9
+	Levels []float64 `toml:"levels"`
+	// a level or the kink is warned again only after utilization falls below it by margin
+	Margin float64 `toml:"margin"`
+	// readable amount of cash below which redeems may fail
+	CashFloor int64 `toml:"cash_floor"`
+}
+
+type WatchlistConfig struct {
+	// borrowers borrowing at least such USD value are watched
+	BorrowUSDThreshold float64 `toml:"borrow_usd_threshold"`
+	// BorrowThreshold is the former name of borrow_usd_threshold, used if borrow_usd_threshold is not set
+	BorrowThreshold float64 `toml:"borrow_threshold"`
+	// accounts with liquidity lower than such percent of borrows are alerted
+	BufferPercent float64 `toml:"buffer_percent"`
+}
+
+type LiquidationConfig struct {
+	// liquidations repaying at least such USD value are alerted one by one
+	USDThreshold float64 `toml:"usd_threshold"`
+	// markets with fewer liquidations in the last hour are left out of the digest
+	DigestMinCount int `toml:"digest_min_count"`
 }
 
 func Get() *Config {
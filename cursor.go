@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"psm-monitor/db"
+)
+
+// trackCursor is the name of the cursor which records the last fully handled block
+const trackCursor = "track"
+
+// cursorName returns the cursor name of handlers which require the given confirmations
+func cursorName(confirmations uint64) string {
+	if confirmations == 0 {
+		return trackCursor
+	}
+	return fmt.Sprintf("%s-%d", trackCursor, confirmations)
+}
+
+type Cursor struct {
+	Name        string `gorm:"primaryKey"`
+	BlockNumber uint64
+	UpdatedAt   time.Time
+}
+
+func initCursor() {
+	_ = db.Get().AutoMigrate(&Cursor{})
+}
+
+func loadCursor(name string) (uint64, bool) {
+	var cursor Cursor
+	if err := db.Get().Where("name = ?", name).Take(&cursor).Error; err != nil {
+		return 0, false
+	}
+	return cursor.BlockNumber, true
+}
+
+func saveCursor(name string, blockNumber uint64) {
+	db.Get().Save(&Cursor{Name: name, BlockNumber: blockNumber})
+}
+
+func deleteCursor(name string) {
+	db.Get().Delete(&Cursor{Name: name})
+}
+
+// pruneCursors deletes cursors other than the given ones, left by confirmations no longer subscribed
+func pruneCursors(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	db.Get().Where("name NOT IN ?", names).Delete(&Cursor{})
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"sync"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var (
+	appDB    *gorm.DB
+	openOnce sync.Once
+)
+
+// Get returns the shared handle of monitor.db, the connection is opened on first use
+func Get() *gorm.DB {
+	openOnce.Do(func() {
+		conn, err := gorm.Open(sqlite.Open("monitor.db"), &gorm.Config{})
+		if err != nil {
+			panic("failed to connect database")
+		}
+		appDB = conn
+	})
+	return appDB
+}
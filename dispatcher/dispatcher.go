@@ -0,0 +1,148 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"psm-monitor/metrics"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+	"psm-monitor/notify"
+)
+
+type Handler func(event *net.Event)
+
+// Subscription is a handler subscribed to events of one contract address
+type Subscription struct {
+	ID            uint64
+	Name          string
+	Address       string
+	Confirmations uint64
+
+	// names of concerned events, empty means all events of the address
+	eventNames map[string]bool
+	handle     Handler
+
+	calls  *metrics.Counter
+	panics *metrics.Counter
+	costMs *metrics.Counter
+}
+
+func (s *Subscription) accepts(event *net.Event) bool {
+	return len(s.eventNames) == 0 || s.eventNames[event.EventName]
+}
+
+// Dispatcher routes tracked events to all subscriptions of the event address
+type Dispatcher struct {
+	lock   sync.RWMutex
+	nextID uint64
+	subs   map[string][]*Subscription
+}
+
+func New() *Dispatcher {
+	return &Dispatcher{subs: make(map[string][]*Subscription)}
+}
+
+// Subscribe registers the handler for events of the address which got the given confirmations,
+// only events with one of the names are handled if any name is given
+func (d *Dispatcher) Subscribe(name, addr string, confirmations uint64, handle Handler, eventNames ...string) *Subscription {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.nextID += 1
+	sub := &Subscription{
+		ID:            d.nextID,
+		Name:          name,
+		Address:       addr,
+		Confirmations: confirmations,
+		eventNames:    make(map[string]bool),
+		handle:        handle,
+		calls:         metrics.GetCounter(fmt.Sprintf("dispatcher.%s.calls", name)),
+		panics:        metrics.GetCounter(fmt.Sprintf("dispatcher.%s.panics", name)),
+		costMs:        metrics.GetCounter(fmt.Sprintf("dispatcher.%s.cost_ms", name)),
+	}
+	for _, eventName := range eventNames {
+		sub.eventNames[eventName] = true
+	}
+	d.subs[addr] = append(d.subs[addr], sub)
+	misc.Info("Dispatcher report", fmt.Sprintf("subscribe id=%d name=%s addr=%s confirmations=%d events=%v",
+		sub.ID, name, addr, confirmations, eventNames))
+	return sub
+}
+
+// Unsubscribe removes the subscription, it returns false if the subscription is not found
+func (d *Dispatcher) Unsubscribe(sub *Subscription) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	subs := d.subs[sub.Address]
+	for i, s := range subs {
+		if s.ID == sub.ID {
+			d.subs[sub.Address] = append(subs[:i:i], subs[i+1:]...)
+			if len(d.subs[sub.Address]) == 0 {
+				delete(d.subs, sub.Address)
+			}
+			misc.Info("Dispatcher report", fmt.Sprintf("unsubscribe id=%d name=%s addr=%s", sub.ID, sub.Name, sub.Address))
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch hands the event to subscriptions requiring the given confirmations,
+// a panic in one handler is recovered and does not affect the others
+func (d *Dispatcher) Dispatch(event *net.Event, confirmations uint64) {
+	d.lock.RLock()
+	subs := d.subs[event.Address]
+	d.lock.RUnlock()
+	for _, sub := range subs {
+		if sub.Confirmations == confirmations && sub.accepts(event) {
+			d.call(sub, event)
+		}
+	}
+}
+
+func (d *Dispatcher) call(sub *Subscription, event *net.Event) {
+	startAt := time.Now()
+	defer func() {
+		sub.calls.Inc(1)
+		sub.costMs.Inc(time.Now().Sub(startAt).Milliseconds())
+		if r := recover(); r != nil {
+			sub.panics.Inc(1)
+			misc.Error("Dispatcher report", fmt.Sprintf("handler=%s tx=%s event=%s panic=\"%v\"",
+				sub.Name, event.TransactionHash, event.EventName, r))
+			notify.ReportPanic(fmt.Sprintf("%s handling %s", sub.Name, event.EventName), fmt.Errorf("%v", r))
+		}
+	}()
+	sub.handle(event)
+}
+
+// Confirmations returns all distinct confirmations required by subscriptions in ascending order
+func (d *Dispatcher) Confirmations() []uint64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	seen := make(map[uint64]bool)
+	confirmations := make([]uint64, 0)
+	for _, subs := range d.subs {
+		for _, sub := range subs {
+			if !seen[sub.Confirmations] {
+				seen[sub.Confirmations] = true
+				confirmations = append(confirmations, sub.Confirmations)
+			}
+		}
+	}
+	sort.Slice(confirmations, func(i, j int) bool { return confirmations[i] < confirmations[j] })
+	return confirmations
+}
+
+// Addresses returns all subscribed contract addresses
+func (d *Dispatcher) Addresses() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	addrs := make([]string, 0, len(d.subs))
+	for addr := range d.subs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
@@ -0,0 +1,33 @@
+package dispatcher
+
+import (
+	"reflect"
+	"testing"
+
+	"psm-monitor/net"
+)
+
+func TestDispatch(t *testing.T) {
+	d := New()
+	var got []string
+	d.Subscribe("a", "TAddr", 0, func(event *net.Event) { got = append(got, "a:"+event.EventName) })
+	sub := d.Subscribe("b", "TAddr", 0, func(event *net.Event) { got = append(got, "b:"+event.EventName) }, "Transfer")
+	d.Subscribe("c", "TAddr", 19, func(event *net.Event) { got = append(got, "c:"+event.EventName) })
+
+	d.Dispatch(&net.Event{Address: "TAddr", EventName: "Transfer"}, 0)
+	d.Dispatch(&net.Event{Address: "TAddr", EventName: "Approval"}, 0)
+	d.Dispatch(&net.Event{Address: "TOther", EventName: "Transfer"}, 0)
+	if !d.Unsubscribe(sub) || d.Unsubscribe(sub) {
+		t.Fatal("unexpected unsubscribe result")
+	}
+	d.Dispatch(&net.Event{Address: "TAddr", EventName: "Transfer"}, 0)
+	d.Dispatch(&net.Event{Address: "TAddr", EventName: "Transfer"}, 19)
+
+	want := []string{"a:Transfer", "b:Transfer", "a:Approval", "a:Transfer", "c:Transfer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(d.Confirmations(), []uint64{0, 19}) {
+		t.Fatalf("unexpected confirmations %v", d.Confirmations())
+	}
+}
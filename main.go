@@ -1,24 +1,23 @@
 package main
 
 import (
+	"psm-monitor/abi"
+	"psm-monitor/config"
+	"psm-monitor/dispatcher"
+	"psm-monitor/metrics"
 	"psm-monitor/misc"
 	"psm-monitor/monitor"
 	"psm-monitor/net"
-	"psm-monitor/slack"
+	"psm-monitor/notify"
+	"psm-monitor/price"
 
-	"fmt"
 	"math/rand"
-	"sync"
 	"time"
 
 	"github.com/robfig/cron"
 )
 
-var (
-	trackedBlockNumber uint64
-	trackedEvent       map[string]func(event *net.Event)
-	trackLock          sync.RWMutex
-)
+var trackedEvent *dispatcher.Dispatcher
 
 func main() {
 	initApp()
@@ -26,9 +25,12 @@ func main() {
 	c := cron.New()
 	monitor.StartPSM(c, trackedEvent)
 	monitor.StartSUN(c, trackedEvent)
+	monitor.StartSunSwap(c, trackedEvent)
 	monitor.StartJST(c, trackedEvent)
 	monitor.StartTrackFee(c)
+	initTracker()
 	_ = c.AddFunc("*/3 * * * * ?", misc.WrapLog(track))
+	_ = c.AddFunc("0 */10 * * * ?", misc.WrapLog(metrics.Report))
 	c.Start()
 
 	defer c.Stop()
@@ -36,39 +38,21 @@ func main() {
 }
 
 func initApp() {
-	slack.SendMsg(":zany_face: [APP]", "Monitor now started, components - [PSM, SUN, JST]")
-	trackedBlockNumber = net.BlockNumber()
-	trackedEvent = make(map[string]func(event *net.Event))
+	notify.SendMsg(":zany_face: [APP]", notify.Info, "Monitor now started, components - [PSM, SUN, SunSwap, JST]")
+	initCursor()
+	trackedEvent = dispatcher.New()
+	initEventSource()
+	price.Register(price.NewHTTPSource())
 	rand.Seed(time.Now().UnixNano())
 }
 
-func track() {
-	trackLock.Lock()
-	defer trackLock.Unlock()
-	latestBlockEvents := net.GetLatestBlockEvents()
-	if len(latestBlockEvents) > 0 {
-		latestBlockNumber := latestBlockEvents[0].BlockNumber
-		if trackedBlockNumber >= latestBlockNumber {
-			// current block has already been tracked
-			misc.Info("Track task report", fmt.Sprintf("block %d is already tracked", trackedBlockNumber))
-		} else {
-			for trackedBlockNumber < latestBlockNumber-1 {
-				trackedBlockNumber += 1
-				events := net.GetBlockEvents(trackedBlockNumber)
-				handleEvents(events)
-				misc.Info("Track task report", fmt.Sprintf("block %d is missed, has %d events", trackedBlockNumber, len(events)))
-			}
-			handleEvents(latestBlockEvents)
-			trackedBlockNumber = latestBlockNumber
-			misc.Info("Track task report", fmt.Sprintf("block %d is latest, has %d events", trackedBlockNumber, len(latestBlockEvents)))
-		}
-	}
-}
-
-func handleEvents(events []*net.Event) {
-	for _, event := range events {
-		if f, ok := trackedEvent[event.Address]; ok {
-			f(event)
-		}
+func initEventSource() {
+	switch config.Get().EventSource {
+	case "fullnode":
+		net.SetEventSource(net.NewFullNodeSource(abi.NewLogDecoder()))
+	case "jsonrpc":
+		net.SetEventSource(net.NewJsonRpcSource(abi.NewLogDecoder(), trackedEvent.Addresses, abi.EventTopics()))
+	default:
+		net.SetEventSource(net.NewTronGridSource(abi.NewLogDecoder()))
 	}
 }
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"psm-monitor/misc"
+)
+
+// Counter is a monotonically increasing value, e.g. handled events
+type Counter struct {
+	value int64
+}
+
+func (c *Counter) Inc(n int64) {
+	atomic.AddInt64(&c.value, n)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// Gauge is a value which can go up and down, e.g. block lag
+type Gauge struct {
+	value int64
+}
+
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+var (
+	counters = make(map[string]*Counter)
+	gauges   = make(map[string]*Gauge)
+	lock     sync.Mutex
+)
+
+// GetCounter returns the counter registered with the name, creating it if absent
+func GetCounter(name string) *Counter {
+	lock.Lock()
+	defer lock.Unlock()
+	if c, ok := counters[name]; ok {
+		return c
+	}
+	c := &Counter{}
+	counters[name] = c
+	return c
+}
+
+// GetGauge returns the gauge registered with the name, creating it if absent
+func GetGauge(name string) *Gauge {
+	lock.Lock()
+	defer lock.Unlock()
+	if g, ok := gauges[name]; ok {
+		return g
+	}
+	g := &Gauge{}
+	gauges[name] = g
+	return g
+}
+
+// Snapshot returns current values of all registered metrics
+func Snapshot() map[string]int64 {
+	lock.Lock()
+	defer lock.Unlock()
+	values := make(map[string]int64, len(counters)+len(gauges))
+	for name, c := range counters {
+		values[name] = c.Value()
+	}
+	for name, g := range gauges {
+		values[name] = g.Value()
+	}
+	return values
+}
+
+// Report logs all registered metrics in name order
+func Report() {
+	values := Snapshot()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		misc.Info("Metrics report", fmt.Sprintf("%s=%d", name, values[name]))
+	}
+}
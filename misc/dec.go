@@ -3,6 +3,7 @@ package misc
 import (
 	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/status-im/keycard-go/hexutils"
 )
@@ -49,6 +50,24 @@ func ToReadableDec(n *big.Int) string {
 	return string(buf[i+1:])
 }
 
+// ToReadableFloat formats the float with comma separated integer part and prec fractional digits
+func ToReadableFloat(f float64, prec int) string {
+	text := strconv.FormatFloat(f, 'f', prec, 64)
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	n, ok := new(big.Int).SetString(intPart, 10)
+	if !ok {
+		return text
+	}
+	if len(fracPart) == 0 {
+		return ToReadableDec(n)
+	}
+	if n.Sign() == 0 && strings.HasPrefix(intPart, "-") {
+		// keep the sign of values like -0.5
+		return "-" + ToReadableDec(n) + "." + fracPart
+	}
+	return ToReadableDec(n) + "." + fracPart
+}
+
 func GetDec(d uint8) *big.Int {
 	decFloat, _ := new(big.Float).SetString("1e" + strconv.Itoa(int(d)))
 	decInt, _ := decFloat.Int(new(big.Int))
@@ -37,6 +37,27 @@ func FormatTokenAmt(token string, amt *big.Int, isDiff bool) string {
 	return text
 }
 
+// FormatTokenFloat is like FormatTokenAmt but keeps fractional digits, for tokens like BTC whose amounts are small
+func FormatTokenFloat(token string, amt float64) string {
+	logo := GetTokenLogo(token)
+	if len(logo) == 0 {
+		logo = token
+	}
+	return fmt.Sprintf("%s - `%s`", logo, ToReadableFloat(amt, 4))
+}
+
+func FormatUSD(value float64) string {
+	return fmt.Sprintf(":dollar: - `%s`", ToReadableFloat(value, 2))
+}
+
+// FormatValue formats the USD value, or marks it unknown if the token has no price
+func FormatValue(value float64, priced bool) string {
+	if !priced {
+		return ":dollar: - `unknown`"
+	}
+	return FormatUSD(value)
+}
+
 func FormatUser(addr string) string {
 	if !strings.HasPrefix(addr, "T") {
 		addr = ToTronAddr(addr)
@@ -48,6 +69,18 @@ func FormatTxUrl(txHash string) string {
 	return fmt.Sprintf(":clippy:<https://tronscan.io/#/transaction/%s|TxHash>", txHash)
 }
 
+// FormatBlock links the block on tronscan, approximate blocks are marked with ~
+func FormatBlock(blockNumber uint64, pinned bool) string {
+	if blockNumber == 0 {
+		return ":bricks: - `unknown`"
+	}
+	prefix := ""
+	if !pinned {
+		prefix = "~"
+	}
+	return fmt.Sprintf(":bricks:<https://tronscan.io/#/block/%d|%s%d>", blockNumber, prefix, blockNumber)
+}
+
 func WrapLog(f func()) func() {
 	return func() {
 		startAt := time.Now()
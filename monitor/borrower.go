@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"psm-monitor/abi"
+	"psm-monitor/alert"
+	"psm-monitor/config"
+	"psm-monitor/db"
+	"psm-monitor/misc"
+	"psm-monitor/multicall"
+	"psm-monitor/price"
+)
+
+var (
+	getAccountLiquidityMethod = abi.MustMethod("getAccountLiquidity(address)", "uint256", "uint256", "uint256")
+	borrowBalanceStoredMethod = abi.MustMethod("borrowBalanceStored(address)", "uint256")
+)
+
+// Borrower is an account on the watchlist of JustLend borrowers, added by a large borrow
+type Borrower struct {
+	Address string `gorm:"primaryKey"`
+	// market symbol and tx of the borrow which added the account
+	Market string
+	TxHash string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func initWatchlist() {
+	_ = db.Get().AutoMigrate(&Borrower{})
+}
+
+// watchBorrower adds the account to the watchlist, an account already on it is kept as is
+func (j *JST) watchBorrower(addr, symbol, txHash string) {
+	result := db.Get().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Borrower{Address: addr, Market: symbol, TxHash: txHash})
+	if result.Error != nil {
+		misc.Warn("JST.watchBorrower", fmt.Sprintf("action=\"watch %s\" reason=\"%s\"", addr, result.Error.Error()))
+		return
+	}
+	if result.RowsAffected > 0 {
+		misc.Info("JST.watchBorrower", fmt.Sprintf("borrower=%s market=j%s tx=%s", addr, symbol, txHash))
+	}
+}
+
+// checkBorrowers queries the liquidity of all watched accounts from the comptroller, and alerts accounts
+// whose liquidity buffer over borrows is below the configured percent or which go into shortfall,
+// keyed by low_buffer.<address> and shortfall.<address>, accounts without any borrow balance are removed from the watchlist
+func (j *JST) checkBorrowers() {
+	var borrowers []*Borrower
+	if err := db.Get().Find(&borrowers).Error; err != nil {
+		misc.Warn("JST.checkBorrowers", fmt.Sprintf("action=\"load watchlist\" reason=\"%s\"", err.Error()))
+		return
+	}
+	if len(borrowers) == 0 {
+		return
+	}
+
+	batch := multicall.New()
+	queriesPerBorrower := 1 + len(j.marketList)
+	for _, b := range borrowers {
+		batch.Add(jController, getAccountLiquidityMethod, b.Address)
+		for _, addr := range j.marketList {
+			batch.Add(addr, borrowBalanceStoredMethod, b.Address)
+		}
+	}
+	results := batch.Do()
+	block := blockOf(results)
+
+	bufferPercent := config.Get().JST.Watchlist.BufferPercent
+	for i, b := range borrowers {
+		base := i * queriesPerBorrower
+		res := results.Results[base]
+		if !res.Success() {
+			misc.Warn("JST.checkBorrowers", fmt.Sprintf("action=\"query liquidity of %s\" reason=\"%s\"", b.Address, res.Err.Error()))
+			continue
+		}
+		if code := res.Values[0].(*big.Int); code.Sign() != 0 {
+			misc.Warn("JST.checkBorrowers", fmt.Sprintf("action=\"query liquidity of %s\" reason=\"comptroller error %s\"", b.Address, code))
+			continue
+		}
+		liquidity, shortfall := toFloat(res.Values[1].(*big.Int), 18), toFloat(res.Values[2].(*big.Int), 18)
+
+		borrowValue, hasBorrows, allQueried, allPriced := 0.0, false, true, true
+		for k, addr := range j.marketList {
+			balance, err := results.Results[base+1+k].BigInt()
+			if err != nil {
+				allQueried = false
+				continue
+			}
+			if balance.Sign() > 0 {
+				hasBorrows = true
+				m := j.markets[addr]
+				value, err := price.Get(m.symbol)
+				if err != nil {
+					allPriced = false
+					misc.Warn("JST.checkBorrowers", fmt.Sprintf("action=\"value borrows of %s\" reason=\"%s\"", b.Address, err.Error()))
+					break
+				}
+				borrowValue += value * toFloat(balance, m.decimals)
+			}
+		}
+		if !hasBorrows && allQueried {
+			db.Get().Delete(b)
+			misc.Info("JST.checkBorrowers", fmt.Sprintf("borrower=%s fully repaid, removed from watchlist", b.Address))
+			alert.Resolve(j.topic, "shortfall."+b.Address, "Borrower fully repaid, %s, at %s", misc.FormatUser(b.Address), block)
+			alert.Resolve(j.topic, "low_buffer."+b.Address, "Borrower fully repaid, %s, at %s", misc.FormatUser(b.Address), block)
+			continue
+		}
+
+		// shortfall is reported by the comptroller in USD, it is judged even if some borrows are not priced
+		if shortfall > 0 {
+			// a shortfall implies low buffer, which is left as is until the account recovers from shortfall
+			alert.Fire(j.topic, "shortfall."+b.Address, alert.Critical, "Borrower goes into shortfall, %s, shortfall %s, borrows %s, at %s",
+				misc.FormatUser(b.Address), misc.FormatUSD(shortfall), misc.FormatValue(borrowValue, allPriced), block)
+			continue
+		}
+		alert.Resolve(j.topic, "shortfall."+b.Address, "Borrower recovers from shortfall, %s, liquidity %s, borrows %s, at %s",
+			misc.FormatUser(b.Address), misc.FormatUSD(liquidity), misc.FormatValue(borrowValue, allPriced), block)
+		if !allPriced {
+			// a partial borrow value makes the buffer look healthier than it is, judge the buffer next round
+			continue
+		}
+		buffer := 100.0
+		if borrowValue > 0 {
+			buffer = liquidity * 100 / borrowValue
+		}
+		if buffer < bufferPercent {
+			alert.Fire(j.topic, "low_buffer."+b.Address, alert.Warning, "Borrower liquidity buffer lower than `%.2f%%`, now `%.2f%%`, %s, liquidity %s, borrows %s, at %s",
+				bufferPercent, buffer, misc.FormatUser(b.Address), misc.FormatUSD(liquidity), misc.FormatUSD(borrowValue), block)
+		} else {
+			alert.Resolve(j.topic, "low_buffer."+b.Address, "Borrower liquidity buffer recovers above `%.2f%%`, now `%.2f%%`, %s, at %s",
+				bufferPercent, buffer, misc.FormatUser(b.Address), block)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"psm-monitor/alert"
+	"psm-monitor/config"
+	"psm-monitor/db"
+	"psm-monitor/misc"
+)
+
+// driftWindow is the period over which the report shows price drift
+const driftWindow = 6 * time.Hour
+
+// PoolPrice is the effective price and the share of one coin in a SUN pool, recorded by each check
+type PoolPrice struct {
+	ID          uint   `gorm:"primaryKey"`
+	Pool        string `gorm:"index"`
+	Coin        string
+	BlockNumber uint64
+	// price of the coin in its quote coin, see pool.quoteCoin
+	Price float64
+	// share of the coin in the pool
+	Share     float64
+	TrackedAt time.Time `gorm:"index"`
+}
+
+func initPoolPrices() {
+	_ = db.Get().AutoMigrate(&PoolPrice{})
+}
+
+// checkDepeg records the prices of the pool and alerts coins trading outside the configured band,
+// the alert of a coin is keyed by depeg.<pool>.<coin> and resolved once its price goes back into the band
+func (s *SUN) checkDepeg(p *pool, state *poolState, block snapshotBlock) {
+	if !state.quoted() {
+		return
+	}
+	shares := p.shares(state)
+	now := time.Now()
+	for i, price := range state.prices {
+		db.Get().Create(&PoolPrice{
+			Pool:        p.name,
+			Coin:        p.coinsName[i],
+			BlockNumber: block.number,
+			Price:       price,
+			Share:       shares[i],
+			TrackedAt:   now,
+		})
+	}
+
+	conf := config.Get().SUN.Depeg
+	for i, price := range state.prices {
+		key := "depeg." + p.name + "." + p.coinsName[i]
+		if price < conf.Lower || price > conf.Upper {
+			alert.Fire(s.topic, key, alert.Critical, "`%s` trades at `%.4f` `%s`, out of `%.4f` ~ `%.4f`, imbalance - `%+.2f%%` in `%s`, at %s",
+				p.coinsName[i], price, p.coinsName[p.quoteCoin(i)], conf.Lower, conf.Upper, p.imbalance(shares, i)*100, p.name, block)
+		} else {
+			alert.Resolve(s.topic, key, "`%s` trades back at `%.4f` `%s` in `%s`, at %s",
+				p.coinsName[i], price, p.coinsName[p.quoteCoin(i)], p.name, block)
+		}
+	}
+}
+
+// reportDrift describes current prices and their drift from the earliest record in the drift window
+func (s *SUN) reportDrift(p *pool, state *poolState) (string, bool) {
+	if !state.quoted() {
+		return "", false
+	}
+	shares := p.shares(state)
+	since := time.Now().Add(-driftWindow)
+	prices, imbalances, drifts := make([]string, len(state.prices)), make([]string, len(state.prices)), make([]string, 0)
+	var earliestAt time.Time
+	for i, price := range state.prices {
+		prices[i] = fmt.Sprintf("`%.4f`", price)
+		imbalances[i] = fmt.Sprintf("`%+.2f%%`", p.imbalance(shares, i)*100)
+		var earliest PoolPrice
+		err := db.Get().Where("pool = ? AND coin = ? AND tracked_at >= ?", p.name, p.coinsName[i], since).
+			Order("tracked_at").Take(&earliest).Error
+		if err == nil && earliest.Price > 0 {
+			drifts = append(drifts, fmt.Sprintf("`%+.3f%%`", (price/earliest.Price-1)*100))
+			earliestAt = earliest.TrackedAt
+		}
+	}
+	msg := fmt.Sprintf("Price - %s, Imbalance - %s", strings.Join(prices, " : "), strings.Join(imbalances, " : "))
+	if len(drifts) == len(state.prices) {
+		msg += fmt.Sprintf(", Drift since `%s` - %s", earliestAt.Format("15:04"), strings.Join(drifts, " : "))
+	}
+	return msg, true
+}
+
+// shares are proportions of coins in the pool
+func (p *pool) shares(state *poolState) []float64 {
+	shares, total := make([]float64, len(state.balances)), 0.0
+	for i, balance := range state.balances {
+		shares[i], _ = new(big.Float).SetInt(balance).Float64()
+		total += shares[i]
+	}
+	for i := range shares {
+		if total > 0 {
+			shares[i] /= total
+		}
+	}
+	return shares
+}
+
+// imbalance is the share of coin i minus its share in a balanced pool
+func (p *pool) imbalance(shares []float64, i int) float64 {
+	return shares[i] - 1/float64(len(shares))
+}
+
+func prunePoolPrices() {
+	retention := config.Get().SUN.Depeg.Retention
+	if retention <= 0 {
+		return
+	}
+	if err := db.Get().Where("tracked_at < ?", time.Now().AddDate(0, 0, -retention)).Delete(&PoolPrice{}).Error; err != nil {
+		misc.Warn("SUN.prunePoolPrices", fmt.Sprintf("reason=\"%s\"", err.Error()))
+	}
+}
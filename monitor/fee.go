@@ -5,11 +5,11 @@ import (
 	"time"
 
 	"github.com/robfig/cron"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"psm-monitor/db"
 	"psm-monitor/misc"
 	"psm-monitor/net"
-	"psm-monitor/slack"
+	"psm-monitor/notify"
 )
 
 type Record struct {
@@ -27,13 +27,8 @@ func StartTrackFee(c *cron.Cron) {
 	_ = c.AddFunc("0 */1 * * * ?", misc.WrapLog(track))
 	_ = c.AddFunc("30 0 2 * * ?", misc.WrapLog(report))
 
-	db, err := gorm.Open(sqlite.Open("monitor.db"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
-	}
-	db.AutoMigrate(&Record{})
-
-	appDB = db
+	appDB = db.Get()
+	appDB.AutoMigrate(&Record{})
 }
 
 func track() {
@@ -69,5 +64,5 @@ func report() {
 	slackMessage += fmt.Sprintf("> USDT 日均手续费: `%.2f$` - `%.2f$` @TRON / `%.2f$` - `%.2f$` @ETH\n", dayAvgs[0], dayAvgs[1], dayAvgs[2], dayAvgs[3])
 	slackMessage += fmt.Sprintf("> USDT 周均手续费: `%.2f$` - `%.2f$` @TRON / `%.2f$` - `%.2f$` @ETH\n", weekAvgs[0], weekAvgs[1], weekAvgs[2], weekAvgs[3])
 
-	slack.ReportFee(slackMessage)
+	notify.ReportFee(slackMessage)
 }
@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"psm-monitor/alert"
+	"psm-monitor/config"
+	"psm-monitor/db"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+	"psm-monitor/price"
+)
+
+// GemFlow is a SellGem or BuyGem event of a psm, recorded for flow accounting
+type GemFlow struct {
+	ID        uint   `gorm:"primaryKey"`
+	TxHash    string `gorm:"uniqueIndex:idx_gem_flow_log"`
+	LogIndex  uint   `gorm:"uniqueIndex:idx_gem_flow_log"`
+	Ilk       string `gorm:"index"`
+	EventName string
+	Sender    string
+	// readable gem amount, positive for SellGem which moves gems into the psm, negative for BuyGem
+	Amount      float64
+	BlockNumber uint64
+	BlockTime   time.Time `gorm:"index"`
+}
+
+func initGemFlows() {
+	_ = db.Get().AutoMigrate(&GemFlow{})
+}
+
+// recordFlow stores the gem event, events replayed after a restart are ignored
+func (p *PSM) recordFlow(event *net.Event, gem *ilk, amount float64) {
+	blockTime := time.UnixMilli(event.BlockTimestamp)
+	if event.BlockTimestamp == 0 {
+		blockTime = time.Now()
+	}
+	err := db.Get().Clauses(clause.OnConflict{DoNothing: true}).Create(&GemFlow{
+		TxHash:      event.TransactionHash,
+		LogIndex:    event.LogIndex,
+		Ilk:         gem.name,
+		EventName:   event.EventName,
+		Sender:      event.Addr("owner"),
+		Amount:      amount,
+		BlockNumber: event.BlockNumber,
+		BlockTime:   blockTime,
+	}).Error
+	if err != nil {
+		misc.Warn("PSM.recordFlow", fmt.Sprintf("tx=%s reason=\"%s\"", event.TransactionHash, err.Error()))
+	}
+}
+
+// DiscardFlows deletes flows recorded from the tx, it is called once the tx is orphaned by a chain reorg
+func DiscardFlows(txHash string) {
+	result := db.Get().Where("tx_hash = ?", txHash).Delete(&GemFlow{})
+	if result.Error != nil {
+		misc.Warn("PSM.DiscardFlows", fmt.Sprintf("tx=%s reason=\"%s\"", txHash, result.Error.Error()))
+		return
+	}
+	if result.RowsAffected > 0 {
+		misc.Info("PSM.DiscardFlows", fmt.Sprintf("tx=%s %d flows discarded", txHash, result.RowsAffected))
+	}
+}
+
+// ilkFlow is the gem volume of an ilk in a window
+type ilkFlow struct {
+	sold   float64
+	bought float64
+}
+
+// summarizeFlows describes gross sold, gross bought and net flow of each ilk in [from, to),
+// followed by the top addresses by USD volume
+func (p *PSM) summarizeFlows(from, to time.Time) string {
+	var flows []*GemFlow
+	if err := db.Get().Where("block_time >= ? AND block_time < ?", from, to).Find(&flows).Error; err != nil {
+		misc.Warn("PSM.summarizeFlows", fmt.Sprintf("action=\"load flows\" reason=\"%s\"", err.Error()))
+		return "flows `unknown`"
+	}
+	ilkFlows, volumes := make(map[string]*ilkFlow), make(map[string]float64)
+	for _, f := range flows {
+		if _, ok := ilkFlows[f.Ilk]; !ok {
+			ilkFlows[f.Ilk] = &ilkFlow{}
+		}
+		if f.Amount > 0 {
+			ilkFlows[f.Ilk].sold += f.Amount
+		} else {
+			ilkFlows[f.Ilk].bought -= f.Amount
+		}
+		// flows of gems without price are left out of volumes
+		if value, err := price.USDFloat(f.Ilk, f.Amount); err == nil {
+			volumes[f.Sender] += math.Abs(value)
+		}
+	}
+
+	texts := make([]string, 0)
+	for _, name := range p.ilkList {
+		flow, ok := ilkFlows[name]
+		if !ok {
+			flow = &ilkFlow{}
+		}
+		texts = append(texts, fmt.Sprintf("%s sold `%s` bought `%s` net `%s`",
+			misc.GetTokenLogo(name),
+			misc.ToReadableFloat(flow.sold, 0),
+			misc.ToReadableFloat(flow.bought, 0),
+			misc.ToReadableFloat(flow.sold-flow.bought, 0)))
+	}
+
+	senders := make([]string, 0, len(volumes))
+	for sender := range volumes {
+		senders = append(senders, sender)
+	}
+	sort.Slice(senders, func(i, j int) bool { return volumes[senders[i]] > volumes[senders[j]] })
+	if topN := config.Get().PSM.Flow.TopN; len(senders) > topN {
+		senders = senders[:topN]
+	}
+	for i, sender := range senders {
+		texts = append(texts, fmt.Sprintf("top %d %s %s", i+1, misc.FormatUser(sender), misc.FormatUSD(volumes[sender])))
+	}
+	return strings.Join(texts, ", ")
+}
+
+// dailySummary posts flows of the last day
+func (p *PSM) dailySummary() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	alert.Send(p.topic, alert.Info, "Daily Summary, from `%s` ~ `%s`, %s",
+		now.Add(-24*time.Hour).Format("01-02 15:04"), now.Format("01-02 15:04"),
+		p.summarizeFlows(now.Add(-24*time.Hour), now))
+}
+
+// dailySpec converts the configured time like 09:00 to the cron spec, it falls back to midnight if invalid
+func dailySpec(at string) string {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		misc.Warn("PSM.dailySpec", fmt.Sprintf("daily_summary=\"%s\" reason=\"%s\", use 00:00", at, err.Error()))
+		return "0 0 0 * * ?"
+	}
+	return fmt.Sprintf("0 %d %d * * ?", t.Minute(), t.Hour())
+}
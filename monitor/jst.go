@@ -1,14 +1,24 @@
 package monitor
 
 import (
+	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"psm-monitor/abi"
+	"psm-monitor/alert"
 	"psm-monitor/config"
+	"psm-monitor/dispatcher"
 	"psm-monitor/misc"
+	"psm-monitor/multicall"
 	"psm-monitor/net"
-	"psm-monitor/slack"
+	"psm-monitor/price"
 
 	"github.com/robfig/cron"
 )
@@ -32,93 +42,653 @@ const (
 	jController = "TGjYzgCyPobsNS9n6WcbdLVR9dH7mWqFx7"
 )
 
+const (
+	// jTokens all have 8 decimals, the exchange rate is scaled by 1e(18 - 8 + underlying decimals)
+	jTokenDecimals = 8
+	// one block every 3 seconds
+	blocksPerDay = 28_800
+)
+
+var (
+	getCashMethod            = abi.MustMethod("getCash()", "uint256")
+	totalBorrowsMethod       = abi.MustMethod("totalBorrows()", "uint256")
+	totalReservesMethod      = abi.MustMethod("totalReserves()", "uint256")
+	totalSupplyMethod        = abi.MustMethod("totalSupply()", "uint256")
+	exchangeRateStoredMethod = abi.MustMethod("exchangeRateStored()", "uint256")
+	supplyRatePerBlockMethod = abi.MustMethod("supplyRatePerBlock()", "uint256")
+	borrowRatePerBlockMethod = abi.MustMethod("borrowRatePerBlock()", "uint256")
+	interestRateModelMethod  = abi.MustMethod("interestRateModel()", "address")
+	kinkMethod               = abi.MustMethod("kink()", "uint256")
+)
+
 type market struct {
 	symbol   string
 	decimals uint8
+
+	// check, report and stats states of the market, states are replaced but never modified in place
+	cState *marketState
+	rState *marketState
+	sState *marketState
+	// cState is also read by the liquidation handler, so it is replaced under the lock
+	stateLock sync.Mutex
+
+	// utilization above which the borrow rate jumps, zero if the rate model has no kink
+	kink float64
+	// utilization levels warned, true for levels fired and false for lower levels implied by them
+	warnedLevels map[float64]bool
+}
+
+// marketState is a snapshot of a market, amounts are readable underlying amounts,
+// supply is the total supply of jToken converted to underlying, rates are raw mantissas
+type marketState struct {
+	cash         *big.Int
+	borrows      *big.Int
+	reserves     *big.Int
+	supply       *big.Int
+	exchangeRate *big.Int
+	supplyRate   *big.Int
+	borrowRate   *big.Int
 }
 
 type JST struct {
 	topic string
 
-	markets map[string]market
-}
-
-func StartJST(c *cron.Cron, concerned map[string]func(event *net.Event)) {
-	jst := &JST{topic: ":justlend: [JST]", markets: make(map[string]market)}
-	jst.markets[jTRX] = market{symbol: "TRX", decimals: 8}
-	jst.markets[jUSDD] = market{symbol: "USDD", decimals: 18}
-	jst.markets[jUSDT] = market{symbol: "USDT", decimals: 6}
-	jst.markets[jSUN] = market{symbol: "SUN", decimals: 18}
-	jst.markets[jBTT] = market{symbol: "BTT", decimals: 18}
-	jst.markets[jNFT] = market{symbol: "NFT", decimals: 6}
-	jst.markets[jJST] = market{symbol: "JST", decimals: 18}
-	jst.markets[jWIN] = market{symbol: "WIN", decimals: 6}
-	jst.markets[jUSDJ] = market{symbol: "USDJ", decimals: 18}
-	jst.markets[jUSDC] = market{symbol: "USDC", decimals: 6}
-	jst.markets[jTUSD] = market{symbol: "TUSD", decimals: 18}
-	jst.markets[jBTC] = market{symbol: "BTC", decimals: 8}
-	jst.markets[jETH] = market{symbol: "ETH", decimals: 18}
+	// market addresses in reporting order
+	marketList []string
+	markets    map[string]*market
+
+	sBlock snapshotBlock
+	sTime  time.Time
+
+	// market address => liquidations repaid in the market since the last digest
+	liquidationLock sync.Mutex
+	liquidations    map[string]*liquidationDigest
+
+	priceSource *price.JustLendSource
+}
+
+// liquidationDigest accumulates liquidations of one borrowed market
+type liquidationDigest struct {
+	count int
+	repay float64
+	usd   float64
+	// collateral symbol => seized underlying amount
+	seized map[string]float64
+}
+
+func StartJST(c *cron.Cron, d *dispatcher.Dispatcher) {
+	jst := &JST{topic: ":justlend: [JST]", markets: make(map[string]*market), sTime: time.Now(),
+		liquidations: make(map[string]*liquidationDigest)}
+	jst.addMarket(jTRX, "TRX", 6)
+	jst.addMarket(jUSDD, "USDD", 18)
+	jst.addMarket(jUSDT, "USDT", 6)
+	jst.addMarket(jSUN, "SUN", 18)
+	jst.addMarket(jBTT, "BTT", 18)
+	jst.addMarket(jNFT, "NFT", 6)
+	jst.addMarket(jJST, "JST", 18)
+	jst.addMarket(jWIN, "WIN", 6)
+	jst.addMarket(jUSDJ, "USDJ", 18)
+	jst.addMarket(jUSDC, "USDC", 6)
+	jst.addMarket(jTUSD, "TUSD", 18)
+	jst.addMarket(jBTC, "BTC", 8)
+	jst.addMarket(jETH, "ETH", 18)
+	jst.initPriceSource()
 	jst.init()
+	initWatchlist()
 
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" */10 * * * ?", misc.WrapLog(jst.check))
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 0 */1 * * ?", misc.WrapLog(jst.report))
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 30 */6 * * ?", misc.WrapLog(jst.stats))
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 0 */1 * * ?", misc.WrapLog(jst.digestLiquidations))
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" */10 * * * ?", misc.WrapLog(jst.checkBorrowers))
 
-	concerned[jUSDD] = jst.handleStableCoin
-	concerned[jUSDT] = jst.handleStableCoin
-	concerned[jUSDJ] = jst.handleStableCoin
-	concerned[jUSDC] = jst.handleStableCoin
-	concerned[jTUSD] = jst.handleStableCoin
+	confirmations := config.Get().JST.Confirmations
+	for _, addr := range jst.marketList {
+		d.Subscribe("JST.handleMarketEvents", addr, confirmations, jst.handleMarketEvents)
+	}
+	d.Subscribe("JST.handleComptrollerEvents", jController, confirmations, jst.handleComptrollerEvents)
 }
 
-func (j *JST) handleStableCoin(event *net.Event) {
-	jMarket := j.markets[event.Address]
-	threshold := big.NewInt(config.Get().JST.StableThreshold)
+// handleMarketEvents alerts events moving large USD value and governance changes of all markets
+func (j *JST) handleMarketEvents(event *net.Event) {
+	m, ok := j.markets[event.Address]
+	if !ok {
+		return
+	}
 	switch event.EventName {
+	case "Mint":
+		j.alertLargeAmount(event, m, event.BigInt("mintAmount"), event.Addr("minter"))
+	case "Redeem":
+		j.alertLargeAmount(event, m, event.BigInt("redeemAmount"), event.Addr("redeemer"))
 	case "Borrow":
-		borrowAmount, _ := new(big.Int).SetString(event.Result["borrowAmount"], 10)
-		borrowAmount = misc.ConvertDecN(borrowAmount, jMarket.decimals)
-		borrower := event.Result["borrower"]
-		if borrowAmount.Cmp(threshold) >= 0 {
-			slack.SendMsg(j.topic, "Large %s, %s, %s, %s",
-				event.EventName,
-				misc.FormatTokenAmt(jMarket.symbol, borrowAmount, false),
-				misc.FormatUser(borrower),
-				misc.FormatTxUrl(event.TransactionHash))
+		borrower := event.Addr("borrower")
+		usdValue := j.alertLargeAmount(event, m, event.BigInt("borrowAmount"), borrower)
+		if usdValue >= borrowUSDThreshold() {
+			j.watchBorrower(borrower, m.symbol, event.TransactionHash)
 		}
-	case "Redeem":
-		redeemAmount, _ := new(big.Int).SetString(event.Result["redeemAmount"], 10)
-		redeemAmount = misc.ConvertDecN(redeemAmount, jMarket.decimals)
-		redeemer := event.Result["redeemer"]
-		if redeemAmount.Cmp(threshold) >= 0 {
-			slack.SendMsg(j.topic, "Large %s, %s, %s, %s",
-				event.EventName,
-				misc.FormatTokenAmt(jMarket.symbol, redeemAmount, false),
-				misc.FormatUser(redeemer),
-				misc.FormatTxUrl(event.TransactionHash))
+	case "RepayBorrow":
+		j.alertLargeAmount(event, m, event.BigInt("repayAmount"), event.Addr("borrower"))
+	case "LiquidateBorrow":
+		j.handleLiquidation(event)
+	case "AccrueInterest":
+		// interest accrues on every market action, only accruals worth the threshold are abnormal
+		interest := toFloat(event.BigInt("interestAccumulated"), m.decimals)
+		if usdValue, err := price.USDFloat(m.symbol, interest); err == nil && usdValue >= j.usdThreshold(m.symbol) {
+			alert.Send(j.topic, alert.Warning, "Large Interest Accrued, %s, %s, total borrows %s, %s in `j%s`",
+				misc.FormatTokenFloat(m.symbol, interest),
+				misc.FormatUSD(usdValue),
+				misc.FormatTokenFloat(m.symbol, toFloat(event.BigInt("totalBorrows"), m.decimals)),
+				misc.FormatTxUrl(event.TransactionHash),
+				m.symbol)
 		}
+	case "ReservesAdded":
+		j.alertLargeAmount(event, m, event.BigInt("addAmount"), event.Addr("benefactor"))
+	case "ReservesReduced":
+		// reserves can only be reduced by the admin, always alert it
+		alert.Send(j.topic, alert.Warning, "Reserves Reduced, %s, %s, total reserves %s, %s in `j%s`",
+			misc.FormatTokenFloat(m.symbol, toFloat(event.BigInt("reduceAmount"), m.decimals)),
+			misc.FormatUser(event.Addr("admin")),
+			misc.FormatTokenFloat(m.symbol, toFloat(event.BigInt("newTotalReserves"), m.decimals)),
+			misc.FormatTxUrl(event.TransactionHash),
+			m.symbol)
+	case "NewReserveFactor":
+		alert.Send(j.topic, alert.Warning, "New Reserve Factor, `%.2f%%` => `%.2f%%`, %s in `j%s`",
+			toFloat(event.BigInt("oldReserveFactorMantissa"), 16),
+			toFloat(event.BigInt("newReserveFactorMantissa"), 16),
+			misc.FormatTxUrl(event.TransactionHash),
+			m.symbol)
+	case "NewMarketInterestRateModel":
+		alert.Send(j.topic, alert.Warning, "New Interest Rate Model, `%s` => `%s`, %s in `j%s`",
+			event.Addr("oldInterestRateModel"),
+			event.Addr("newInterestRateModel"),
+			misc.FormatTxUrl(event.TransactionHash),
+			m.symbol)
 	}
 }
 
-func (j *JST) handleMarketEvents(event *net.Event) {
+// alertLargeAmount alerts the event if the amount is worth more than the USD threshold of the market,
+// it returns the USD value of the amount, zero if the market has no price
+func (j *JST) alertLargeAmount(event *net.Event, m *market, amount *big.Int, user string) float64 {
+	readable := toFloat(amount, m.decimals)
+	usdValue, err := price.USDFloat(m.symbol, readable)
+	if err != nil {
+		return 0
+	}
+	if usdValue >= j.usdThreshold(m.symbol) {
+		alert.Send(j.topic, alert.Warning, "Large %s, %s, %s, %s, %s in `j%s`",
+			event.EventName,
+			misc.FormatTokenFloat(m.symbol, readable),
+			misc.FormatUSD(usdValue),
+			misc.FormatUser(user),
+			misc.FormatTxUrl(event.TransactionHash),
+			m.symbol)
+	}
+	return usdValue
+}
+
+// handleComptrollerEvents alerts all governance-level parameter changes of the comptroller
+func (j *JST) handleComptrollerEvents(event *net.Event) {
 	switch event.EventName {
-	case "LiquidateBorrow":
+	case "MarketListed":
+		alert.Send(j.topic, alert.Warning, "New Market Listed, `%s`, %s",
+			j.marketName(event.Addr("cToken")),
+			misc.FormatTxUrl(event.TransactionHash))
+	case "NewCollateralFactor":
+		alert.Send(j.topic, alert.Warning, "New Collateral Factor, `%.2f%%` => `%.2f%%`, %s in `%s`",
+			toFloat(event.BigInt("oldCollateralFactorMantissa"), 16),
+			toFloat(event.BigInt("newCollateralFactorMantissa"), 16),
+			misc.FormatTxUrl(event.TransactionHash),
+			j.marketName(event.Addr("cToken")))
+	case "NewBorrowCap":
+		borrowCap := event.BigInt("newBorrowCap")
+		capText := "unlimited"
+		if m, ok := j.markets[event.Addr("cToken")]; ok && borrowCap.Sign() > 0 {
+			capText = misc.FormatTokenFloat(m.symbol, toFloat(borrowCap, m.decimals))
+		} else if borrowCap.Sign() > 0 {
+			capText = "`" + borrowCap.String() + "`"
+		} else {
+			capText = "`" + capText + "`"
+		}
+		alert.Send(j.topic, alert.Warning, "New Borrow Cap, %s, %s in `%s`",
+			capText,
+			misc.FormatTxUrl(event.TransactionHash),
+			j.marketName(event.Addr("cToken")))
+	case "ActionPaused":
+		state := "unpaused"
+		if event.Bool("pauseState") {
+			state = "paused"
+		}
+		scope := "all markets"
+		if cToken := event.Addr("cToken"); len(cToken) > 0 {
+			scope = j.marketName(cToken)
+		}
+		alert.Send(j.topic, alert.Critical, "Action `%s` is %s, %s in `%s`",
+			event.Text("action"),
+			state,
+			misc.FormatTxUrl(event.TransactionHash),
+			scope)
+	case "NewCloseFactor":
+		alert.Send(j.topic, alert.Warning, "New Close Factor, `%.2f%%` => `%.2f%%`, %s",
+			toFloat(event.BigInt("oldCloseFactorMantissa"), 16),
+			toFloat(event.BigInt("newCloseFactorMantissa"), 16),
+			misc.FormatTxUrl(event.TransactionHash))
+	case "NewLiquidationIncentive":
+		alert.Send(j.topic, alert.Warning, "New Liquidation Incentive, `%.2f%%` => `%.2f%%`, %s",
+			toFloat(event.BigInt("oldLiquidationIncentiveMantissa"), 16),
+			toFloat(event.BigInt("newLiquidationIncentiveMantissa"), 16),
+			misc.FormatTxUrl(event.TransactionHash))
+	case "NewPriceOracle":
+		j.priceSource.ResetOracle()
+		alert.Send(j.topic, alert.Critical, "New Price Oracle, `%s` => `%s`, %s",
+			event.Addr("oldPriceOracle"),
+			event.Addr("newPriceOracle"),
+			misc.FormatTxUrl(event.TransactionHash))
+	}
+}
 
+// marketName returns the jToken name of known markets, or the address of unknown ones
+func (j *JST) marketName(addr string) string {
+	if m, ok := j.markets[addr]; ok {
+		return "j" + m.symbol
 	}
+	return addr
 }
 
-func (j *JST) init() {
+func (j *JST) usdThreshold(symbol string) float64 {
+	conf := config.Get().JST
+	if threshold, ok := conf.USDThresholds[symbol]; ok {
+		return threshold
+	}
+	if conf.USDThreshold == 0 {
+		return conf.StableThreshold
+	}
+	return conf.USDThreshold
+}
+
+func borrowUSDThreshold() float64 {
+	conf := config.Get().JST.Watchlist
+	if conf.BorrowUSDThreshold == 0 {
+		return conf.BorrowThreshold
+	}
+	return conf.BorrowUSDThreshold
+}
+
+// handleLiquidation alerts large liquidations and accumulates all of them for the hourly digest,
+// the event is emitted by the borrowed market, seized jTokens are converted to the collateral underlying
+func (j *JST) handleLiquidation(event *net.Event) {
+	borrowed, ok := j.markets[event.Address]
+	if !ok {
+		return
+	}
+	repayAmount := toFloat(event.BigInt("repayAmount"), borrowed.decimals)
+	collateralAddr := event.Addr("cTokenCollateral")
+	collateral, ok := j.markets[collateralAddr]
+	var seizeAmount float64
+	if ok {
+		seizeAmount = collateral.seizedUnderlying(collateralAddr, event.BigInt("seizeTokens"))
+	} else {
+		// an unknown market, show seized jTokens with the market address
+		collateral = &market{symbol: collateralAddr}
+		seizeAmount = toFloat(event.BigInt("seizeTokens"), jTokenDecimals)
+	}
+	usdValue, err := price.USDFloat(borrowed.symbol, repayAmount)
+	priced := err == nil
+
+	j.liquidationLock.Lock()
+	digest, ok := j.liquidations[event.Address]
+	if !ok {
+		digest = &liquidationDigest{seized: make(map[string]float64)}
+		j.liquidations[event.Address] = digest
+	}
+	digest.count += 1
+	digest.repay += repayAmount
+	if priced {
+		digest.usd += usdValue
+	}
+	digest.seized[collateral.symbol] += seizeAmount
+	j.liquidationLock.Unlock()
+
+	if priced && usdValue >= config.Get().JST.Liquidation.USDThreshold {
+		alert.Send(j.topic, alert.Warning, "Large Liquidation, repay %s, seize %s, %s, liquidator %s, borrower %s, %s",
+			misc.FormatTokenFloat(borrowed.symbol, repayAmount),
+			misc.FormatTokenFloat(collateral.symbol, seizeAmount),
+			misc.FormatUSD(usdValue),
+			misc.FormatUser(event.Addr("liquidator")),
+			misc.FormatUser(event.Addr("borrower")),
+			misc.FormatTxUrl(event.TransactionHash))
+	}
+}
+
+func (j *JST) digestLiquidations() {
+	j.liquidationLock.Lock()
+	liquidations := j.liquidations
+	j.liquidations = make(map[string]*liquidationDigest)
+	j.liquidationLock.Unlock()
+
+	minCount := config.Get().JST.Liquidation.DigestMinCount
+	lines := make([]string, 0)
+	for _, addr := range j.marketList {
+		digest, ok := liquidations[addr]
+		if !ok || digest.count < minCount {
+			continue
+		}
+		symbols := make([]string, 0, len(digest.seized))
+		for symbol := range digest.seized {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		seized := make([]string, 0, len(symbols))
+		for _, symbol := range symbols {
+			seized = append(seized, misc.FormatTokenFloat(symbol, digest.seized[symbol]))
+		}
+		lines = append(lines, fmt.Sprintf("> `j%s` `%d` liquidations, repay %s, %s, seize %s",
+			j.markets[addr].symbol, digest.count,
+			misc.FormatTokenFloat(j.markets[addr].symbol, digest.repay),
+			misc.FormatUSD(digest.usd),
+			strings.Join(seized, ", ")))
+	}
+	if len(lines) > 0 {
+		alert.Send(j.topic, alert.Info, "Liquidation Digest in last `1h`\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+// seizedUnderlying converts seized jTokens of the market to the underlying amount,
+// using the current exchange rate or the one of the last check if it cannot be queried
+func (m *market) seizedUnderlying(addr string, seizeTokens *big.Int) float64 {
+	exchangeRate, err := exchangeRateStoredMethod.CallBigInt(addr)
+	if err != nil {
+		misc.Warn("JST.seizedUnderlying", fmt.Sprintf("action=\"query j%s exchange rate\" reason=\"%s\"", m.symbol, err.Error()))
+		m.stateLock.Lock()
+		state := m.cState
+		m.stateLock.Unlock()
+		if state == nil {
+			return 0
+		}
+		exchangeRate = state.exchangeRate
+	}
+	// seizeTokens * exchangeRate / 1e18 is the underlying amount
+	return toFloat(new(big.Int).Mul(seizeTokens, exchangeRate), 18+m.decimals)
+}
 
+// initPriceSource registers the price oracle of the comptroller as a price source of all market underlying
+func (j *JST) initPriceSource() {
+	markets := make(map[string]price.JToken)
+	for _, addr := range j.marketList {
+		markets[j.markets[addr].symbol] = price.JToken{Addr: addr, Decimals: j.markets[addr].decimals}
+	}
+	j.priceSource = price.NewJustLendSource(jController, markets)
+	price.Register(j.priceSource)
+}
+
+func (j *JST) addMarket(addr, symbol string, decimals uint8) {
+	j.marketList = append(j.marketList, addr)
+	j.markets[addr] = &market{symbol: symbol, decimals: decimals, warnedLevels: make(map[float64]bool)}
+}
+
+func (j *JST) init() {
+	j.initKinks()
+	states, block := j.snapshot()
+	for _, addr := range j.marketList {
+		j.markets[addr].setCState(states[addr])
+		j.markets[addr].sState = states[addr]
+	}
+	j.sBlock = block
+	j.report()
 }
 
 func (j *JST) check() {
+	states, block := j.snapshot()
+	reportThreshold := float64(config.Get().JST.ReportThreshold)
+	for _, addr := range j.marketList {
+		m, state := j.markets[addr], states[addr]
+		diffCash := new(big.Int).Sub(state.cash, m.cState.cash)
+		diffBorrows := new(big.Int).Sub(state.borrows, m.cState.borrows)
+		usdCash, err := price.USD(m.symbol, diffCash)
+		usdBorrows, _ := price.USD(m.symbol, diffBorrows)
+		if err == nil && (math.Abs(usdCash) >= reportThreshold || math.Abs(usdBorrows) >= reportThreshold) {
+			alert.Send(j.topic, alert.Warning, "Large market change in last `10min`, cash %s, %s, borrows %s, %s in `j%s`, at %s",
+				misc.FormatTokenAmt(m.symbol, diffCash, true), misc.FormatUSD(math.Abs(usdCash)),
+				misc.FormatTokenAmt(m.symbol, diffBorrows, true), misc.FormatUSD(math.Abs(usdBorrows)),
+				m.symbol, block)
+		}
+		m.setCState(state)
+	}
+	j.checkUtilization(block)
+}
+
+// checkUtilization alerts markets approaching full utilization, whose redeems may start failing,
+// alerts of levels, the kink and the cash floor are keyed by utilization.<symbol>.<level>, kink.<symbol>
+// and low_cash.<symbol>, and resolved once utilization falls below them by margin or cash recovers
+func (j *JST) checkUtilization(block snapshotBlock) {
+	conf := config.Get().JST.Utilization
+	cashFloor := big.NewInt(conf.CashFloor)
+	for _, addr := range j.marketList {
+		m := j.markets[addr]
+		if !contains(conf.Markets, m.symbol) {
+			continue
+		}
+		utilization := m.cState.utilization()
 
+		// levels are resolved once utilization falls below them by the margin, implied ones silently
+		for level, fired := range m.warnedLevels {
+			if utilization < level-conf.Margin {
+				if fired {
+					alert.Resolve(j.topic, utilizationKey(m.symbol, level), "Utilization of `j%s` falls below `%.2f%%`, now `%.2f%%`, at %s",
+						m.symbol, level*100, utilization*100, block)
+				}
+				delete(m.warnedLevels, level)
+			}
+		}
+		crossed, highest := 0.0, 0.0
+		for _, level := range conf.Levels {
+			if utilization >= level {
+				crossed = level
+			}
+		}
+		for level := range m.warnedLevels {
+			highest = math.Max(highest, level)
+		}
+		// only the highest crossed level is alerted, it is repeated after the cooldown while it persists,
+		// a level implied by a higher one fired before is not alerted when utilization falls back to it
+		if crossed > 0 && (crossed > highest || crossed == highest && m.warnedLevels[crossed]) {
+			alert.Fire(j.topic, utilizationKey(m.symbol, crossed), alert.Warning, "Utilization of `j%s` is above `%.2f%%`, now `%.2f%%`, cash %s, at %s",
+				m.symbol, crossed*100, utilization*100, misc.FormatTokenAmt(m.symbol, m.cState.cash, false), block)
+			for _, level := range conf.Levels {
+				if level < crossed && !m.warnedLevels[level] {
+					m.warnedLevels[level] = false
+				}
+			}
+			m.warnedLevels[crossed] = true
+		}
+
+		if m.kink > 0 {
+			if utilization >= m.kink {
+				alert.Fire(j.topic, "kink."+m.symbol, alert.Warning, "Utilization of `j%s` passes the kink `%.2f%%`, now `%.2f%%`, borrow APY - `%.2f%%`, at %s",
+					m.symbol, m.kink*100, utilization*100, toAPY(m.cState.borrowRate), block)
+			}
+			if utilization < m.kink-conf.Margin {
+				alert.Resolve(j.topic, "kink."+m.symbol, "Utilization of `j%s` falls below the kink `%.2f%%`, now `%.2f%%`, borrow APY - `%.2f%%`, at %s",
+					m.symbol, m.kink*100, utilization*100, toAPY(m.cState.borrowRate), block)
+			}
+		}
+
+		if m.cState.cash.Cmp(cashFloor) < 0 {
+			alert.Fire(j.topic, "low_cash."+m.symbol, alert.Warning, "Cash of `j%s` lower than %s, now %s, at %s",
+				m.symbol, misc.ToReadableDec(cashFloor), misc.FormatTokenAmt(m.symbol, m.cState.cash, false), block)
+		} else {
+			alert.Resolve(j.topic, "low_cash."+m.symbol, "Cash of `j%s` recovers above %s, now %s, at %s",
+				m.symbol, misc.ToReadableDec(cashFloor), misc.FormatTokenAmt(m.symbol, m.cState.cash, false), block)
+		}
+	}
 }
 
-func (j *JST) report() {
+// utilizationKey is the alert key of the utilization level of the market, like utilization.USDT.90
+func utilizationKey(symbol string, level float64) string {
+	return fmt.Sprintf("utilization.%s.%d", symbol, int(math.Round(level*100)))
+}
 
+// initKinks queries the kink of rate models of all markets, it is zero for models without kink
+func (j *JST) initKinks() {
+	batch := multicall.New()
+	for _, addr := range j.marketList {
+		batch.Add(addr, interestRateModelMethod)
+	}
+	models := batch.Do()
+	batch = multicall.New()
+	kinkIdx := make(map[string]int)
+	for i, addr := range j.marketList {
+		if model := models.Results[i]; model.Success() {
+			kinkIdx[addr] = batch.Add(model.Values[0].(string), kinkMethod)
+		}
+	}
+	kinks := batch.Do()
+	for addr, idx := range kinkIdx {
+		if kink, err := kinks.Results[idx].BigInt(); err == nil {
+			j.markets[addr].kink = toFloat(kink, 18)
+		} else {
+			misc.Debug("JST.initKinks", fmt.Sprintf("action=\"query j%s kink\" reason=\"%s\"", j.markets[addr].symbol, err.Error()))
+		}
+	}
+}
+
+func (j *JST) report() {
+	states, block := j.snapshot()
+	lines := make([]string, 0, len(j.marketList))
+	for _, addr := range j.marketList {
+		m, state := j.markets[addr], states[addr]
+		lines = append(lines, fmt.Sprintf("> `j%s` Cash - `%s`, Borrows - `%s`, Reserves - `%s`, Supply - `%s`, Utilization - `%.2f%%`, Exchange Rate - `%.8f`, APY - `%.2f%%` : `%.2f%%`",
+			m.symbol,
+			misc.ToReadableDec(state.cash),
+			misc.ToReadableDec(state.borrows),
+			misc.ToReadableDec(state.reserves),
+			misc.ToReadableDec(state.supply),
+			state.utilization()*100,
+			m.readableExchangeRate(state.exchangeRate),
+			toAPY(state.supplyRate),
+			toAPY(state.borrowRate)))
+		m.rState = state
+	}
+	alert.Send(j.topic, alert.Info, "State Report, at %s\n%s", block, strings.Join(lines, "\n"))
 }
 
 func (j *JST) stats() {
+	states, block := j.snapshot()
+	now := time.Now()
+	lines := make([]string, 0, len(j.marketList))
+	for _, addr := range j.marketList {
+		m, state := j.markets[addr], states[addr]
+		lines = append(lines, fmt.Sprintf("> `j%s` Cash %s, Borrows %s, Reserves %s, Supply %s",
+			m.symbol,
+			misc.FormatTokenAmt(m.symbol, new(big.Int).Sub(state.cash, m.sState.cash), true),
+			misc.FormatTokenAmt(m.symbol, new(big.Int).Sub(state.borrows, m.sState.borrows), true),
+			misc.FormatTokenAmt(m.symbol, new(big.Int).Sub(state.reserves, m.sState.reserves), true),
+			misc.FormatTokenAmt(m.symbol, new(big.Int).Sub(state.supply, m.sState.supply), true)))
+		m.sState = state
+	}
+	alert.Send(j.topic, alert.Info, "Stats Report, from `%s` ~ `%s`, blocks %s ~ %s\n%s",
+		j.sTime.Format("15:04"), now.Format("15:04"), j.sBlock, block, strings.Join(lines, "\n"))
+	j.sBlock, j.sTime = block, now
+}
+
+// snapshot reads states of all markets in one batch at the latest block, so that they are consistent
+func (j *JST) snapshot() (map[string]*marketState, snapshotBlock) {
+	batch := multicall.New()
+	methods := []*abi.Method{getCashMethod, totalBorrowsMethod, totalReservesMethod, totalSupplyMethod,
+		exchangeRateStoredMethod, supplyRatePerBlockMethod, borrowRatePerBlockMethod}
+	for _, addr := range j.marketList {
+		for _, method := range methods {
+			batch.Add(addr, method)
+		}
+	}
+	results := batch.Do()
+	states := make(map[string]*marketState)
+	for i, addr := range j.marketList {
+		values := make([]*big.Int, len(methods))
+		for k, method := range methods {
+			value, err := results.Results[i*len(methods)+k].BigInt()
+			if err != nil {
+				misc.Warn(fmt.Sprintf("%s.%s", j.topic, method.Name), fmt.Sprintf("action=\"query j%s\" reason=\"%s\"", j.markets[addr].symbol, err.Error()))
+			}
+			values[k] = value
+		}
+		states[addr] = j.markets[addr].toState(values)
+	}
+	return states, blockOf(results)
+}
+
+func (m *market) setCState(state *marketState) {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.cState = state
+}
+
+// toState converts raw values queried in snapshot, failed values fall back to those of the c-state
+func (m *market) toState(values []*big.Int) *marketState {
+	prev := m.cState
+	if prev == nil {
+		prev = &marketState{}
+	}
+	pick := func(value, fallback *big.Int, decimals uint8) *big.Int {
+		if value == nil {
+			if fallback == nil {
+				return big.NewInt(0)
+			}
+			return fallback
+		}
+		if decimals == 0 {
+			return value
+		}
+		return misc.ConvertDecN(new(big.Int).Set(value), decimals)
+	}
+	state := &marketState{
+		cash:         pick(values[0], prev.cash, m.decimals),
+		borrows:      pick(values[1], prev.borrows, m.decimals),
+		reserves:     pick(values[2], prev.reserves, m.decimals),
+		exchangeRate: pick(values[4], prev.exchangeRate, 0),
+		supplyRate:   pick(values[5], prev.supplyRate, 0),
+		borrowRate:   pick(values[6], prev.borrowRate, 0),
+	}
+	if values[3] != nil && values[4] != nil {
+		// totalSupply * exchangeRate / 1e18 is the underlying amount
+		supply := new(big.Int).Mul(values[3], values[4])
+		state.supply = misc.ConvertDecN(supply, 18+m.decimals)
+	} else {
+		state.supply = pick(nil, prev.supply, 0)
+	}
+	return state
+}
 
+// utilization is borrows / (cash + borrows - reserves)
+func (s *marketState) utilization() float64 {
+	total := new(big.Int).Add(s.cash, s.borrows)
+	total.Sub(total, s.reserves)
+	if total.Sign() <= 0 {
+		return 0
+	}
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(s.borrows), new(big.Float).SetInt(total)).Float64()
+	return f
+}
+
+// readableExchangeRate returns underlying amount of one jToken
+func (m *market) readableExchangeRate(rate *big.Int) float64 {
+	return toFloat(rate, 18-jTokenDecimals+m.decimals)
+}
+
+func toFloat(amt *big.Int, decimals uint8) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(amt), new(big.Float).SetInt(misc.GetDec(decimals))).Float64()
+	return f
+}
+
+// toAPY converts the rate per block mantissa to annual percentage yield, compounded daily like the JustLend app
+func toAPY(ratePerBlock *big.Int) float64 {
+	return (math.Pow(1+toFloat(ratePerBlock, 18)*blocksPerDay, 365) - 1) * 100
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,70 +1,97 @@
 package monitor
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"psm-monitor/abi"
+	"psm-monitor/alert"
 	"psm-monitor/config"
+	"psm-monitor/dispatcher"
 	"psm-monitor/misc"
+	"psm-monitor/multicall"
 	"psm-monitor/net"
-	"psm-monitor/slack"
+	"psm-monitor/price"
 
 	"github.com/robfig/cron"
 )
 
 type ilk struct {
+	name    string
 	token   string
 	gemJoin string
 	psm     string
 	decimal uint8
+
+	// vat and the ilk identifier in vat, read from the psm
+	vat   string
+	ilkID []byte
+
+	// swap fees in wad, nil if unknown, feeLock guards them as they are updated by both File events and check
+	feeLock sync.Mutex
+	tin     *big.Int
+	tout    *big.Int
+
+	sub *dispatcher.Subscription
+}
+
+// thresholds returns gem and report thresholds of the ilk
+func (i *ilk) thresholds() (float64, float64) {
+	conf := config.Get().PSM
+	gem, report := conf.GemThreshold, conf.ReportThreshold
+	for _, ic := range conf.Ilks {
+		if ic.Token != i.token {
+			continue
+		}
+		if ic.GemThreshold > 0 {
+			gem = ic.GemThreshold
+		}
+		if ic.ReportThreshold > 0 {
+			report = ic.ReportThreshold
+		}
+	}
+	return float64(gem), float64(report)
+}
+
+// same tells whether the ilk is still the one declared by the config
+func (i *ilk) same(ic config.IlkConfig) bool {
+	return i.token == ic.Token && i.gemJoin == ic.GemJoin && i.psm == ic.PSM
 }
 
 const (
 	USDD         = "USDD"
 	USDD_DaiJoin = "TMgSSHn8APyUVViqXxtveqFEB7mBBeGqNP"
-	USDT         = "USDT"
-	USDC         = "USDC"
-	TUSD         = "TUSD"
-	USDJ         = "USDJ"
 )
 
-var ilkList = [...]string{"USDT", "USDC", "TUSD", "USDJ"}
-var ilks = map[string]*ilk{
-	USDT: {
-		token:   "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
-		gemJoin: "TMn5WeW8a8KH9o8rBQux4RCgckD2SuMZmS",
-		psm:     "TM9gWuCdFGNMiT1qTq1bgw4tNhJbsESfjA",
-		decimal: 6,
-	},
-	USDC: {
-		token:   "TEkxiTehnzSmSe2XqrBj4w32RUN966rdz8",
-		gemJoin: "TRGTuMiDYAbztetdndYyMzYvtaRmucjz5q",
-		psm:     "TUcj1rpMgJCcFZULyq7uLbkmfh9xMnYTmA",
-		decimal: 6,
-	},
-	TUSD: {
-		token:   "TUpMhErZL2fhh4sVNULAbNKLokS4GjC1F4",
-		gemJoin: "TPxcmB9dQC3LHswCNEc4rJs1HFGb8McYjT",
-		psm:     "TY2op6AKcEkFhv8hxNJj3FBUfjManxYLSe",
-		decimal: 18,
-	},
-	USDJ: {
-		token:   "TMwFHYXLJaRUPeW6421aqXL4ZEzPRFGkGT",
-		gemJoin: "TKAovR61zwp1t9Rg1UE4UY5mXt7QTJdDXg",
-		psm:     "TVS3rVDUSd3ySeXV5moRH2J2t5B9reJfLR",
-		decimal: 18,
-	},
-}
+var (
+	getUsddBalanceMethod = abi.MustMethod("getUsddBalance()", "uint256")
+	tinMethod            = abi.MustMethod("tin()", "uint256")
+	toutMethod           = abi.MustMethod("tout()", "uint256")
+	vatMethod            = abi.MustMethod("vat()", "address")
+	psmIlkMethod         = abi.MustMethod("ilk()", "bytes32")
+	vatIlksMethod        = abi.MustMethod("ilks(bytes32)", "uint256", "uint256", "uint256", "uint256", "uint256")
+)
+
+// radDecimals is the decimals of vat debts and ceilings
+const radDecimals = 45
 
 type PSM struct {
 	topic string
-	ilks  map[string]*ilk
+	d     *dispatcher.Dispatcher
 
-	isLowUSDDWarned bool
+	// all tracked ilks in the order of config, lock guards them and balances as syncIlks changes them at runtime
+	lock    sync.Mutex
+	ilkList []string
+	ilks    map[string]*ilk
+	// token => symbol resolved for ilks declared without name
+	names map[string]string
 
 	// check balances for all tracked token
 	cBalance map[string]*big.Int
@@ -72,133 +99,396 @@ type PSM struct {
 	// report balances for all tracked token
 	rBalance map[string]*big.Int
 
-	// stats balances for all tracked token
+	// stats balance of the vault USDD, gem flows are summarized from GemFlow records
 	sBalance map[string]*big.Int
+	sBlock   snapshotBlock
 	sTime    time.Time
 }
 
-func StartPSM(c *cron.Cron, concerned map[string]func(event *net.Event)) {
+func StartPSM(c *cron.Cron, d *dispatcher.Dispatcher) {
 	psm := &PSM{
 		topic:    ":usdd: [PSM]",
+		d:        d,
+		ilks:     make(map[string]*ilk),
+		names:    make(map[string]string),
 		cBalance: make(map[string]*big.Int),
 		rBalance: make(map[string]*big.Int),
 		sBalance: make(map[string]*big.Int),
 		sTime:    time.Now(),
 	}
+	for _, ic := range psm.validIlks() {
+		if _, err := psm.addIlk(ic); err != nil {
+			misc.Warn("PSM.StartPSM", fmt.Sprintf("ilk=%s reason=\"%s\", retry in the next sync", ic.Name, err.Error()))
+		}
+	}
+	initGemFlows()
 	psm.init()
 
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" */10 * * * ?", misc.WrapLog(psm.check))
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 0 */1 * * ?", misc.WrapLog(psm.report))
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 30 */6 * * ?", misc.WrapLog(psm.stats))
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" * * * * ?", misc.WrapLog(psm.syncIlks))
+	_ = c.AddFunc(dailySpec(config.Get().PSM.Flow.DailySummary), misc.WrapLog(psm.dailySummary))
+}
 
-	for _, name := range ilkList {
-		concerned[ilks[name].psm] = psm.handleGemEvents
+// validIlks returns ilks of the config with names resolved, incomplete or duplicated ones are skipped
+func (p *PSM) validIlks() []config.IlkConfig {
+	valid, seen := make([]config.IlkConfig, 0), make(map[string]bool)
+	for _, ic := range config.Get().PSM.Ilks {
+		if len(ic.Token) == 0 || len(ic.GemJoin) == 0 || len(ic.PSM) == 0 {
+			misc.Warn("PSM.validIlks", fmt.Sprintf("ilk=%s reason=\"incomplete addresses\", skip it", ic.Name))
+			continue
+		}
+		if len(ic.Name) == 0 {
+			ic.Name = p.nameOf(ic.Token)
+		}
+		if len(ic.Name) == 0 || seen[ic.Name] {
+			misc.Warn("PSM.validIlks", fmt.Sprintf("ilk=%s token=%s reason=\"unknown or duplicated name\", skip it", ic.Name, ic.Token))
+			continue
+		}
+		seen[ic.Name] = true
+		valid = append(valid, ic)
 	}
+	return valid
 }
 
-func (p *PSM) handleGemEvents(event *net.Event) {
-	var matchedName string
-	for _, name := range ilkList {
-		if strings.Compare(event.Address, ilks[name].psm) == 0 {
-			matchedName = name
+// nameOf returns the symbol of the token, it is queried only until resolved
+func (p *PSM) nameOf(token string) string {
+	if name, ok := p.names[token]; ok {
+		return name
+	}
+	name := abi.Name(token)
+	if len(name) > 0 {
+		p.names[token] = name
+	}
+	return name
+}
+
+// addIlk starts tracking the ilk, its balances are left to the caller,
+// it fails if the decimals of the gem cannot be queried, so that amounts are never scaled by a guessed decimals
+func (p *PSM) addIlk(ic config.IlkConfig) (*ilk, error) {
+	decimals, err := abi.DecimalsOf(ic.Token)
+	if err != nil {
+		return nil, fmt.Errorf("query decimals of %s: %w", ic.Token, err)
+	}
+	gem := &ilk{name: ic.Name, token: ic.Token, gemJoin: ic.GemJoin, psm: ic.PSM, decimal: decimals}
+	if values, err := vatMethod.Call(gem.psm); err == nil {
+		gem.vat = values[0].(string)
+	} else {
+		misc.Warn("PSM.addIlk", fmt.Sprintf("action=\"query vat of %s\" reason=\"%s\"", gem.name, err.Error()))
+	}
+	if values, err := psmIlkMethod.Call(gem.psm); err == nil {
+		gem.ilkID = values[0].([]byte)
+	} else {
+		misc.Warn("PSM.addIlk", fmt.Sprintf("action=\"query ilk of %s\" reason=\"%s\"", gem.name, err.Error()))
+	}
+	gem.sub = p.d.Subscribe("PSM.handleGemEvents", gem.psm, config.Get().PSM.Confirmations, func(event *net.Event) {
+		p.handleGemEvents(event, gem)
+	}, "SellGem", "BuyGem", "File")
+	p.ilkList = append(p.ilkList, gem.name)
+	p.ilks[gem.name] = gem
+	return gem, nil
+}
+
+func (p *PSM) removeIlk(name string) *ilk {
+	gem := p.ilks[name]
+	p.d.Unsubscribe(gem.sub)
+	for i := range p.ilkList {
+		if p.ilkList[i] == name {
+			p.ilkList = append(p.ilkList[:i:i], p.ilkList[i+1:]...)
+			break
+		}
+	}
+	delete(p.ilks, name)
+	delete(p.cBalance, name)
+	delete(p.rBalance, name)
+	return gem
+}
+
+// syncIlks applies ilks added to or removed from the config, and confirms the changes in slack
+func (p *PSM) syncIlks() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	declared := p.validIlks()
+	isDeclared := make(map[string]bool)
+	for _, ic := range declared {
+		if gem, ok := p.ilks[ic.Name]; ok && gem.same(ic) {
+			isDeclared[ic.Name] = true
+		}
+	}
+	for _, name := range append([]string{}, p.ilkList...) {
+		if !isDeclared[name] {
+			gem := p.removeIlk(name)
+			alert.Send(p.topic, alert.Info, "Ilk `%s` removed, stop monitoring gem join `%s` and psm `%s`", name, gem.gemJoin, gem.psm)
+		}
+	}
+	for _, ic := range declared {
+		if _, ok := p.ilks[ic.Name]; ok {
+			continue
+		}
+		gem, err := p.addIlk(ic)
+		if err != nil {
+			misc.Warn("PSM.syncIlks", fmt.Sprintf("ilk=%s reason=\"%s\", retry in the next sync", ic.Name, err.Error()))
+			continue
+		}
+		balance, err := abi.BalanceOf(gem.token, gem.gemJoin)
+		if err != nil {
+			misc.Warn("PSM.syncIlks", fmt.Sprintf("action=\"query %s balance\" reason=\"%s\"", gem.name, err.Error()))
 		}
+		balance = misc.ConvertDecN(balance, gem.decimal)
+		p.cBalance[gem.name], p.rBalance[gem.name] = balance, big.NewInt(-1)
+		alert.Send(p.topic, alert.Info, "Ilk `%s` added, gem `%s` with decimals `%d`, gem join `%s`, psm `%s`, %s",
+			gem.name, gem.token, gem.decimal, gem.gemJoin, gem.psm, misc.FormatTokenAmt(gem.name, balance, false))
 	}
-	amount, _ := new(big.Int).SetString(event.Result["value"], 10)
-	amount = misc.ConvertDecN(amount, ilks[matchedName].decimal)
+	// keep the order of config
+	p.ilkList = p.ilkList[:0]
+	for _, ic := range declared {
+		if _, ok := p.ilks[ic.Name]; ok {
+			p.ilkList = append(p.ilkList, ic.Name)
+		}
+	}
+}
+
+func (p *PSM) handleGemEvents(event *net.Event, gem *ilk) {
+	if event.EventName == "File" {
+		what := string(bytes.TrimRight(event.Bytes("what"), "\x00"))
+		if what == "tin" || what == "tout" {
+			p.updateFee(gem, what, event.BigInt("data"), misc.FormatTxUrl(event.TransactionHash))
+		} else {
+			alert.Send(p.topic, alert.Critical, "File `%s` of `%s` psm, data - `%s`, %s",
+				what, gem.name, event.BigInt("data"), misc.FormatTxUrl(event.TransactionHash))
+		}
+		return
+	}
+	amount := misc.ConvertDecN(event.BigInt("value"), gem.decimal)
 	if strings.Compare(event.EventName, "BuyGem") == 0 {
 		amount = amount.Neg(amount)
 	}
-	if amount.CmpAbs(big.NewInt(config.Get().PSM.GemThreshold)) >= 0 {
-		slack.SendMsg(p.topic, "Large %s, %s, %s, %s",
+	flow := toFloat(event.BigInt("value"), gem.decimal)
+	if amount.Sign() < 0 {
+		flow = -flow
+	}
+	p.recordFlow(event, gem, flow)
+	gemThreshold, _ := gem.thresholds()
+	usdValue, err := price.USD(gem.name, amount)
+	if usdValue = math.Abs(usdValue); err == nil && usdValue >= gemThreshold {
+		alert.Send(p.topic, alert.Warning, "Large %s, %s, %s, %s, %s",
 			event.EventName,
-			misc.FormatTokenAmt(matchedName, amount, true),
+			misc.FormatTokenAmt(gem.name, amount, true),
+			misc.FormatUSD(usdValue),
 			misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
 			misc.FormatTxUrl(event.TransactionHash))
 	}
 }
 
+// updateFee records the swap fee of the ilk, and alerts if it is changed, where tells the tx or block seeing the change
+func (p *PSM) updateFee(gem *ilk, what string, fee *big.Int, where string) {
+	gem.feeLock.Lock()
+	defer gem.feeLock.Unlock()
+	prev := &gem.tin
+	if what == "tout" {
+		prev = &gem.tout
+	}
+	if *prev != nil && (*prev).Cmp(fee) != 0 {
+		alert.Send(p.topic, alert.Critical, "Fee `%s` of `%s` psm changed, `%s` => `%s`, %s",
+			what, gem.name, formatFee(*prev), formatFee(fee), where)
+	}
+	*prev = fee
+}
+
+// formatFee shows the fee in wad as percent
+func formatFee(fee *big.Int) string {
+	if fee == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.2f%%", toFloat(fee, 18)*100)
+}
+
 func (p *PSM) init() {
-	p.cBalance[USDD] = p.getUSDDBalance()
+	state := p.snapshot()
+	p.cBalance[USDD] = state.balances[USDD]
 	p.rBalance[USDD] = big.NewInt(-1)
 	p.sBalance[USDD] = p.cBalance[USDD]
-	for _, name := range ilkList {
-		p.cBalance[name] = p.getTokenBalance(name)
+	for _, name := range p.ilkList {
+		p.cBalance[name] = state.balances[name]
 		p.rBalance[name] = big.NewInt(-1)
-		p.sBalance[name] = p.cBalance[name]
+		p.ilks[name].tin, p.ilks[name].tout = state.ilks[name].tin, state.ilks[name].tout
 	}
+	p.sBlock = state.block
 	p.report()
 }
 
 func (p *PSM) check() {
-	// check if each ilk`s balance change big
-	reportThreshold := big.NewInt(config.Get().PSM.ReportThreshold)
-	for _, name := range ilkList {
-		balanceOfToken := p.getTokenBalance(name)
-		diff := big.NewInt(0)
-		diff = diff.Sub(balanceOfToken, p.cBalance[name])
-		if diff.CmpAbs(reportThreshold) >= 0 {
-			slack.SendMsg(p.topic, "Large gem balance change in last `10min`, %s",
-				misc.FormatTokenAmt(name, diff, true))
+	p.lock.Lock()
+	isLarge := false
+	defer func() {
+		p.lock.Unlock()
+		if isLarge {
 			p.report()
 		}
+	}()
+	state := p.snapshot()
+
+	// check if each ilk`s balance change big
+	for _, name := range p.ilkList {
+		_, reportThreshold := p.ilks[name].thresholds()
+		balanceOfToken := state.balances[name]
+		diff := new(big.Int).Sub(balanceOfToken, p.cBalance[name])
+		key := "gem_balance." + name
+		if usdValue, err := price.USD(name, diff); err != nil {
+			// without price the change cannot be judged, the alert is kept as is
+		} else if math.Abs(usdValue) >= reportThreshold {
+			// a persisting change is repeated only after the cooldown, and so is the report following it
+			if alert.Fire(p.topic, key, alert.Warning, "Large gem balance change in last `10min`, %s, %s, at %s",
+				misc.FormatTokenAmt(name, diff, true), misc.FormatUSD(math.Abs(usdValue)), state.block) {
+				isLarge = true
+			}
+		} else {
+			alert.Resolve(p.topic, key, "Gem balance of `%s` settled, %s in last `10min`, at %s",
+				name, misc.FormatTokenAmt(name, diff, true), state.block)
+		}
 		p.cBalance[name] = balanceOfToken
 	}
 
+	// check if fees are changed without File events seen, and if debts are close to ceilings
+	debtPercent := config.Get().PSM.DebtPercent
+	for _, name := range p.ilkList {
+		gem, ilkState := p.ilks[name], state.ilks[name]
+		if ilkState.tin != nil {
+			p.updateFee(gem, "tin", ilkState.tin, "at "+state.block.String())
+		}
+		if ilkState.tout != nil {
+			p.updateFee(gem, "tout", ilkState.tout, "at "+state.block.String())
+		}
+		if ilkState.line <= 0 || debtPercent <= 0 {
+			continue
+		}
+		usage := ilkState.debt / ilkState.line * 100
+		if usage >= debtPercent {
+			alert.Fire(p.topic, "debt."+name, alert.Warning, "Debt of `%s` ilk reached `%.2f%%` of ceiling, %s, at %s",
+				name, usage, formatDebt(ilkState), state.block)
+		} else {
+			alert.Resolve(p.topic, "debt."+name, "Debt of `%s` ilk dropped to `%.2f%%` of ceiling, %s, at %s",
+				name, usage, formatDebt(ilkState), state.block)
+		}
+	}
+
 	// check if Vault remained USDD balance lower than threshold
-	balanceOfUSDD := p.getUSDDBalance()
+	balanceOfUSDD := state.balances[USDD]
 	daiThreshold := big.NewInt(config.Get().PSM.DaiThreshold)
-	if !p.isLowUSDDWarned && balanceOfUSDD.CmpAbs(daiThreshold) < 0 {
-		p.isLowUSDDWarned = true
-		slack.SendMsg(p.topic, "Vault remained USDD balance lower than %s",
+	if balanceOfUSDD.CmpAbs(daiThreshold) < 0 {
+		alert.Fire(p.topic, "low_usdd", alert.Warning, "Vault remained USDD balance lower than %s",
 			misc.ToReadableDec(daiThreshold))
-	}
-	if balanceOfUSDD.CmpAbs(daiThreshold) >= 0 {
-		p.isLowUSDDWarned = false
+	} else {
+		alert.Resolve(p.topic, "low_usdd", "Vault USDD balance recovered, %s",
+			misc.FormatTokenAmt(USDD, balanceOfUSDD, false))
 	}
 	p.cBalance[USDD] = balanceOfUSDD
 }
 
 func (p *PSM) report() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	state := p.snapshot()
 	ilkReportStr := ""
-	for _, name := range ilkList {
-		p.rBalance[name] = p.getTokenBalance(name)
+	for _, name := range p.ilkList {
+		p.rBalance[name] = state.balances[name]
 		ilkReportStr += ", " + misc.FormatTokenAmt(name, p.rBalance[name], false)
+		ilkState := state.ilks[name]
+		ilkReportStr += fmt.Sprintf(" (tin `%s`, tout `%s`, %s)", formatFee(ilkState.tin), formatFee(ilkState.tout), formatDebt(ilkState))
 	}
-	slack.SendMsg(p.topic, "State Report, %s%s",
-		misc.FormatTokenAmt(USDD, p.getUSDDBalance(), false), ilkReportStr)
+	alert.Send(p.topic, alert.Info, "State Report, %s%s, at %s",
+		misc.FormatTokenAmt(USDD, state.balances[USDD], false), ilkReportStr, state.block)
 }
 
 func (p *PSM) stats() {
-	balanceOfUSDD, now := p.getUSDDBalance(), time.Now()
-	ilkStatsStr := ""
-	for _, name := range ilkList {
-		balanceOfToken := p.getTokenBalance(name)
-		ilkStatsStr += ", " + misc.FormatTokenAmt(name, p.sBalance[name].Sub(balanceOfToken, p.sBalance[name]), true)
-	}
-	slack.SendMsg(p.topic, "Stats Report, from `%s` ~ `%s`, %s%s",
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	state, now := p.snapshot(), time.Now()
+	alert.Send(p.topic, alert.Info, "Stats Report, from `%s` ~ `%s`, %s, %s, blocks %s ~ %s",
 		p.sTime.Format("15:04"), now.Format("15:04"),
-		misc.FormatTokenAmt(USDD, p.sBalance[USDD].Sub(balanceOfUSDD, p.sBalance[USDD]), true),
-		ilkStatsStr)
-	p.sBalance[USDD], p.sTime = balanceOfUSDD, now
+		misc.FormatTokenAmt(USDD, new(big.Int).Sub(state.balances[USDD], p.sBalance[USDD]), true),
+		p.summarizeFlows(p.sTime, now), p.sBlock, state.block)
+	p.sBalance[USDD], p.sBlock, p.sTime = state.balances[USDD], state.block, now
 }
 
-func (p *PSM) getUSDDBalance() *big.Int {
-	result, err := net.Trigger(USDD_DaiJoin, "getUsddBalance()", "")
-	if err != nil {
-		// if we cannot get current USDD balance, return the c-value
-		misc.Warn(p.topic+".getUSDDBalance", fmt.Sprintf("action=\"%s\" reason=\"%s\"", "query USDD balance", err.Error()))
-		return p.cBalance[USDD]
+// psmState is a snapshot of the vault USDD balance and all gem balances, keyed by token name
+type psmState struct {
+	block    snapshotBlock
+	balances map[string]*big.Int
+	ilks     map[string]*ilkState
+}
+
+// ilkState is a snapshot of swap fees of the psm and the debt of the ilk in vat
+type ilkState struct {
+	// fees in wad, nil if unknown
+	tin  *big.Int
+	tout *big.Int
+	// debt and ceiling in USDD, zero line means unknown
+	debt float64
+	line float64
+}
+
+func formatDebt(s *ilkState) string {
+	if s.line <= 0 {
+		return "debt `unknown`"
+	}
+	return fmt.Sprintf("debt `%s` / `%s` (`%.2f%%`)",
+		misc.ToReadableFloat(s.debt, 0), misc.ToReadableFloat(s.line, 0), s.debt/s.line*100)
+}
+
+// snapshot reads all balances in one batch at the latest block, so that they are consistent
+func (p *PSM) snapshot() *psmState {
+	batch := multicall.New()
+	usddIdx := batch.Add(USDD_DaiJoin, getUsddBalanceMethod)
+	balanceIdx, tinIdx, toutIdx, vatIdx := make([]int, len(p.ilkList)), make([]int, len(p.ilkList)), make([]int, len(p.ilkList)), make([]int, len(p.ilkList))
+	for i, name := range p.ilkList {
+		gem := p.ilks[name]
+		balanceIdx[i] = batch.Add(gem.token, abi.BalanceOfMethod, gem.gemJoin)
+		tinIdx[i] = batch.Add(gem.psm, tinMethod)
+		toutIdx[i] = batch.Add(gem.psm, toutMethod)
+		vatIdx[i] = -1
+		if len(gem.vat) > 0 && gem.ilkID != nil {
+			vatIdx[i] = batch.Add(gem.vat, vatIlksMethod, gem.ilkID)
+		}
 	}
-	return misc.ConvertDec6(misc.ToBigInt(result))
+	results := batch.Do()
+	state := &psmState{block: blockOf(results), balances: make(map[string]*big.Int), ilks: make(map[string]*ilkState)}
+	state.balances[USDD] = p.pickBalance(USDD, results.Results[usddIdx], 6)
+	for i, name := range p.ilkList {
+		state.balances[name] = p.pickBalance(name, results.Results[balanceIdx[i]], p.ilks[name].decimal)
+		ilkState := &ilkState{}
+		if tin, err := results.Results[tinIdx[i]].BigInt(); err == nil {
+			ilkState.tin = tin
+		}
+		if tout, err := results.Results[toutIdx[i]].BigInt(); err == nil {
+			ilkState.tout = tout
+		}
+		if vatIdx[i] >= 0 {
+			if res := results.Results[vatIdx[i]]; res.Err == nil {
+				// debt is Art * rate in rad
+				art, rate, line := res.Values[0].(*big.Int), res.Values[1].(*big.Int), res.Values[3].(*big.Int)
+				ilkState.debt, ilkState.line = toFloat(new(big.Int).Mul(art, rate), radDecimals), toFloat(line, radDecimals)
+			} else {
+				misc.Warn("PSM.get"+name+"Debt", fmt.Sprintf("action=\"query %s debt\" reason=\"%s\"", name, res.Err.Error()))
+			}
+		}
+		state.ilks[name] = ilkState
+	}
+	return state
 }
 
-func (p *PSM) getTokenBalance(name string) *big.Int {
-	result, err := net.Trigger(ilks[name].token, "balanceOf(address)", misc.ToEthAddr(ilks[name].gemJoin))
+func (p *PSM) pickBalance(name string, result *multicall.Result, decimal uint8) *big.Int {
+	balance, err := result.BigInt()
 	if err != nil {
 		// if we cannot get current balance, return the c-value
 		misc.Warn(fmt.Sprintf("%s.get%sBalance", p.topic, name),
 			fmt.Sprintf("action=\"query %s balance\" reason=\"%s\"", name, err.Error()))
-		return p.cBalance[name]
+		if balance, ok := p.cBalance[name]; ok {
+			return balance
+		}
+		return big.NewInt(0)
 	}
-	return misc.ConvertDecN(misc.ToBigInt(result), ilks[name].decimal)
+	return misc.ConvertDecN(balance, decimal)
 }
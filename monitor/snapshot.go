@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"psm-monitor/misc"
+	"psm-monitor/multicall"
+)
+
+// snapshotBlock is the block a periodic snapshot is taken at
+type snapshotBlock struct {
+	number uint64
+	// pinned is false if the values may come from different blocks around number
+	pinned bool
+}
+
+func blockOf(results *multicall.Results) snapshotBlock {
+	return snapshotBlock{number: results.BlockNumber, pinned: results.Pinned}
+}
+
+func (b snapshotBlock) String() string {
+	return misc.FormatBlock(b.number, b.pinned)
+}
@@ -2,12 +2,16 @@ package monitor
 
 import (
 	"psm-monitor/abi"
+	"psm-monitor/alert"
 	"psm-monitor/config"
+	"psm-monitor/dispatcher"
 	"psm-monitor/misc"
+	"psm-monitor/multicall"
 	"psm-monitor/net"
-	"psm-monitor/slack"
+	"psm-monitor/price"
 
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
 	"strconv"
@@ -17,11 +21,12 @@ import (
 	"github.com/robfig/cron"
 )
 
-const (
-	USDD_2Pool_Name = "USDD-2pool"
-	USDD_2Pool      = "TNTfaTpkdd4AQDeqr8SGG7tgdkdjdhbP5c"
-	TUSD_2Pool_Name = "TUSD-2pool"
-	TUSD_2Pool      = "TS8d3ZrSxiGZkqhJqMzFKHEC1pjaowFMBJ"
+// maxCoins is the max number of coins of a curve style pool
+const maxCoins = 8
+
+var (
+	aMethod     = abi.MustMethod("A()", "uint256")
+	getDyMethod = abi.MustMethod("get_dy(int128,int128,uint256)", "uint256")
 )
 
 type pool struct {
@@ -32,6 +37,10 @@ type pool struct {
 	coinsName []string
 	coinsDec  []uint8
 
+	// underlying coins of a meta pool, coin0 of the meta pool followed by coins of the base pool
+	underlyingName []string
+	underlyingDec  []uint8
+
 	// check balances for this pool
 	cPoolBalances []*big.Int
 
@@ -41,8 +50,6 @@ type pool struct {
 
 	// stats balances for this pool
 	sPoolBalances []*big.Int
-
-	removeOneGot bool
 }
 
 func (p *pool) init(n int) {
@@ -57,39 +64,122 @@ func (p *pool) init(n int) {
 		p.coinsAddr[i] = abi.Coins(p.addr, uint64(i))
 		p.coinsName[i] = abi.Name(p.coinsAddr[i])
 		p.coinsDec[i] = abi.Decimals(p.coinsAddr[i])
-
-		p.cPoolBalances[i] = p.getPoolBalance(i)
 		p.rPoolBalances[i] = big.NewInt(-1)
-		p.sPoolBalances[i] = p.cPoolBalances[i]
 	}
 }
 
-func (p *pool) getA() int64 {
-	if result, err := net.Trigger(p.addr, "A()", ""); err == nil {
-		return misc.ToBigInt(result).Int64()
-	} else {
-		// if we cannot get current pool A value, return the pre-value
-		misc.Warn(p.name+".getA", fmt.Sprintf("action=\"%s\" reason=\"%s\"", "query A value", err.Error()))
-		return p.preA
+// initUnderlying resolves underlying coins of the meta pool, coins of the base pool are queried until coins() fails
+func (p *pool) initUnderlying(basePool string) {
+	p.underlyingName = append([]string{}, p.coinsName[:len(p.coinsName)-1]...)
+	p.underlyingDec = append([]uint8{}, p.coinsDec[:len(p.coinsDec)-1]...)
+	for i := uint64(0); i < maxCoins; i++ {
+		coinAddr := abi.Coins(basePool, i)
+		if len(coinAddr) == 0 {
+			break
+		}
+		p.underlyingName = append(p.underlyingName, abi.Name(coinAddr))
+		p.underlyingDec = append(p.underlyingDec, abi.Decimals(coinAddr))
+	}
+}
+
+// quoteCoin is the coin which coin i is quoted in, for two coins pools they are quoted in each other
+func (p *pool) quoteCoin(i int) int {
+	return (i + 1) % len(p.coinsAddr)
+}
+
+// thresholds returns swap, liquidity and report thresholds of the pool
+func (p *pool) thresholds() (float64, float64, float64) {
+	conf := config.Get().SUN
+	swap, liquidity, report := conf.SwapThreshold, conf.LiquidityThreshold, conf.ReportThreshold
+	for _, pc := range conf.Pools {
+		if pc.Name != p.name {
+			continue
+		}
+		if pc.SwapThreshold > 0 {
+			swap = pc.SwapThreshold
+		}
+		if pc.LiquidityThreshold > 0 {
+			liquidity = pc.LiquidityThreshold
+		}
+		if pc.ReportThreshold > 0 {
+			report = pc.ReportThreshold
+		}
+	}
+	return float64(swap), float64(liquidity), float64(report)
+}
+
+// poolState is a snapshot of coin balances and A value of a pool
+type poolState struct {
+	balances []*big.Int
+	a        int64
+	// prices[i] is the effective price of coin i in its quote coin for a trade of the configured size,
+	// zero if it cannot be quoted
+	prices []float64
+}
+
+// quoted tells whether all coins are quoted
+func (s *poolState) quoted() bool {
+	for _, price := range s.prices {
+		if price == 0 {
+			return false
+		}
 	}
+	return len(s.prices) > 0
 }
 
-func (p *pool) getPoolBalance(i int) *big.Int {
-	if res, err := abi.Balances(p.addr, i); err == nil {
-		return misc.ConvertDecN(res, p.coinsDec[i])
-	} else {
-		// if we cannot get current coin pool balance, return the c-value
-		misc.Warn(p.name+".getPoolBalance", fmt.Sprintf("action=query \"%s\" pool balance in \"%s\" failed, reason=\"%s\"", p.coinsName[i], p.name, err.Error()))
-		return p.cPoolBalances[i]
+// addQueries appends queries of the pool state to the batch, and returns a func picking the state from results
+func (p *pool) addQueries(batch *multicall.Batch) func(results *multicall.Results) *poolState {
+	balanceIdx := make([]int, len(p.coinsAddr))
+	for i := range p.coinsAddr {
+		balanceIdx[i] = batch.Add(p.addr, abi.BalancesMethod, i)
+	}
+	aIdx := batch.Add(p.addr, aMethod)
+	// quote the trade size of each coin in its quote coin
+	tradeSize := big.NewInt(config.Get().SUN.Depeg.TradeSize)
+	dyIdx := make([]int, len(p.coinsAddr))
+	for i := range p.coinsAddr {
+		dyIdx[i] = batch.Add(p.addr, getDyMethod, i, p.quoteCoin(i), new(big.Int).Mul(tradeSize, misc.GetDec(p.coinsDec[i])))
+	}
+	return func(results *multicall.Results) *poolState {
+		state := &poolState{balances: make([]*big.Int, len(p.coinsAddr)), a: p.preA, prices: make([]float64, len(p.coinsAddr))}
+		for i, idx := range balanceIdx {
+			if res, err := results.Results[idx].BigInt(); err == nil {
+				state.balances[i] = misc.ConvertDecN(res, p.coinsDec[i])
+			} else {
+				// if we cannot get current coin pool balance, use the c-value
+				misc.Warn(p.name+".getPoolBalance", fmt.Sprintf("action=query \"%s\" pool balance in \"%s\" failed, reason=\"%s\"", p.coinsName[i], p.name, err.Error()))
+				state.balances[i] = p.cPoolBalances[i]
+				if state.balances[i] == nil {
+					state.balances[i] = big.NewInt(0)
+				}
+			}
+		}
+		if res, err := results.Results[aIdx].BigInt(); err == nil {
+			state.a = res.Int64()
+		} else {
+			// if we cannot get current pool A value, use the pre-value
+			misc.Warn(p.name+".getA", fmt.Sprintf("action=\"%s\" reason=\"%s\"", "query A value", err.Error()))
+		}
+		for i, idx := range dyIdx {
+			if dy, err := results.Results[idx].BigInt(); err == nil && tradeSize.Sign() > 0 {
+				f, _ := new(big.Float).Quo(new(big.Float).SetInt(dy), new(big.Float).SetInt(misc.GetDec(p.coinsDec[p.quoteCoin(i)]))).Float64()
+				state.prices[i] = f / float64(tradeSize.Int64())
+			} else if err != nil {
+				misc.Warn(p.name+".getDy", fmt.Sprintf("action=\"quote %s\" reason=\"%s\"", p.coinsName[i], err.Error()))
+			}
+		}
+		return state
 	}
 }
 
 type SUN struct {
 	topic string
 
-	// all tracked pools
-	pools map[string]*pool
-	sTime time.Time
+	// all tracked pools, in the order of config
+	poolList []string
+	pools    map[string]*pool
+	sBlock   snapshotBlock
+	sTime    time.Time
 }
 
 type oneCoinTx struct {
@@ -98,7 +188,7 @@ type oneCoinTx struct {
 	} `json:"trigger_info"`
 }
 
-func StartSUN(c *cron.Cron, concerned map[string]func(event *net.Event)) {
+func StartSUN(c *cron.Cron, d *dispatcher.Dispatcher) {
 	sun := &SUN{topic: ":sunio: [SUN]", sTime: time.Now()}
 
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" */10 * * * ?", misc.WrapLog(sun.check))
@@ -106,63 +196,69 @@ func StartSUN(c *cron.Cron, concerned map[string]func(event *net.Event)) {
 	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 30 */6 * * ?", misc.WrapLog(sun.stats))
 
 	sun.pools = make(map[string]*pool)
-	sun.pools[USDD_2Pool_Name] = &pool{
-		name: USDD_2Pool_Name,
-		addr: USDD_2Pool,
+	for _, pc := range config.Get().SUN.Pools {
+		if pc.Coins < 2 {
+			misc.Warn("SUN.StartSUN", fmt.Sprintf("pool=%s reason=\"%d coins\", skip it", pc.Name, pc.Coins))
+			continue
+		}
+		p := &pool{name: pc.Name, addr: pc.Address}
+		p.init(pc.Coins)
+		if len(pc.BasePool) > 0 {
+			p.initUnderlying(pc.BasePool)
+		}
+		sun.poolList = append(sun.poolList, pc.Name)
+		sun.pools[pc.Name] = p
 	}
-	sun.pools[USDD_2Pool_Name].init(2)
-	sun.pools[TUSD_2Pool_Name] = &pool{
-		name: TUSD_2Pool_Name,
-		addr: TUSD_2Pool,
+	for _, v := range sun.pools {
+		// quote pool coins against USDT
+		for i, name := range v.coinsName {
+			if strings.Compare(name, "USDT") == 0 {
+				price.Register(price.NewPoolSource(v.name, v.addr, v.coinsName, v.coinsDec, i))
+			}
+		}
 	}
-	sun.pools[TUSD_2Pool_Name].init(2)
 
+	confirmations := config.Get().SUN.Confirmations
 	for _, v := range sun.pools {
-		concerned[v.addr] = func(event *net.Event) {
-			sun.handleSwapSwapPoolEvent(event, v)
-		}
-		concerned[v.coinsAddr[0]] = func(event *net.Event) {
-			sun.handleSwapSwapPoolEvent(event, v)
-		}
-		concerned[v.coinsAddr[1]] = func(event *net.Event) {
-			sun.handleSwapSwapPoolEvent(event, v)
+		pool := v
+		handle := func(event *net.Event) {
+			sun.handleSwapSwapPoolEvent(event, pool)
 		}
+		d.Subscribe("SUN."+pool.name, pool.addr, confirmations, handle)
 	}
 
 	sun.init()
 }
 
 func (s *SUN) handleSwapSwapPoolEvent(event *net.Event, pool *pool) {
+	swapThreshold, liquidityThreshold, _ := pool.thresholds()
 	switch event.EventName {
-	case "TokenExchange":
-		var (
-			boughtToken string
-			soldToken   string
-		)
-		boughtAmount, _ := new(big.Int).SetString(event.Result["tokens_bought"], 10)
-		soldAmount, _ := new(big.Int).SetString(event.Result["tokens_sold"], 10)
-		if strings.Compare(event.Result["sold_id"], "0") == 0 {
-			// swap coin0 => coin1
-			boughtToken = pool.coinsName[1]
-			boughtAmount = misc.ConvertDecN(boughtAmount, pool.coinsDec[1])
-			soldToken = pool.coinsName[0]
-			soldAmount = misc.ConvertDecN(soldAmount, pool.coinsDec[0])
-		} else {
-			// swap coin1 => coin0
-			boughtToken = pool.coinsName[0]
-			boughtAmount = misc.ConvertDecN(boughtAmount, pool.coinsDec[0])
-			soldToken = pool.coinsName[1]
-			soldAmount = misc.ConvertDecN(soldAmount, pool.coinsDec[1])
+	case "TokenExchange", "TokenExchangeUnderlying":
+		names, decs := pool.coinsName, pool.coinsDec
+		if event.EventName == "TokenExchangeUnderlying" {
+			names, decs = pool.underlyingName, pool.underlyingDec
+		}
+		soldID, boughtID := int(event.BigInt("sold_id").Int64()), int(event.BigInt("bought_id").Int64())
+		if soldID < 0 || soldID >= len(names) || boughtID < 0 || boughtID >= len(names) {
+			misc.Warn(pool.name+".handleSwapSwapPoolEvent", fmt.Sprintf("tx=%s reason=\"unknown coin %d => %d\"", event.TransactionHash, soldID, boughtID))
+			return
 		}
+		boughtToken, soldToken := names[boughtID], names[soldID]
+		boughtAmount := misc.ConvertDecN(event.BigInt("tokens_bought"), decs[boughtID])
+		soldAmount := misc.ConvertDecN(event.BigInt("tokens_sold"), decs[soldID])
 		diff := big.NewInt(0)
 		diff = diff.Sub(soldAmount, boughtAmount)
-		threshold := big.NewInt(config.Get().SUN.SwapThreshold)
-		if boughtAmount.Cmp(threshold) > 0 {
-			msg := appendWarningIfNeeded(fmt.Sprintf("Large %s, %s => %s, %s, ",
+		usdValue, err := price.USD(boughtToken, boughtAmount)
+		if err != nil {
+			usdValue, err = price.USD(soldToken, soldAmount)
+		}
+		if err == nil && usdValue > swapThreshold {
+			msg := fmt.Sprintf("Large %s, %s => %s, %s, %s, ",
 				event.EventName,
 				misc.FormatTokenAmt(soldToken, soldAmount, false),
 				misc.FormatTokenAmt(boughtToken, boughtAmount, false),
-				misc.FormatUser(net.GetTxFrom(event.TransactionHash))), boughtToken)
+				misc.FormatUSD(usdValue),
+				misc.FormatUser(net.GetTxFrom(event.TransactionHash)))
 			if diff.Sign() > 0 {
 				msg += fmt.Sprintf("lose %s, slip - `%.3f%%`, ",
 					misc.FormatTokenAmt(boughtToken, diff, false),
@@ -173,146 +269,219 @@ func (s *SUN) handleSwapSwapPoolEvent(event *net.Event, pool *pool) {
 					float64(diff.Uint64())/float64(soldAmount.Uint64())*100)
 			}
 			msg += misc.FormatTxUrl(event.TransactionHash)
-			slack.SendMsg(s.topic, msg+" in `"+pool.name+"`")
+			alert.Send(s.topic, severityOfRemoved(boughtToken), msg+" in `"+pool.name+"`")
 		}
 	case "AddLiquidity":
-		s.reportLiquidityOperation(event, pool, false)
+		s.reportLiquidityOperation(event, pool, false, liquidityThreshold)
 	case "RemoveLiquidity", "RemoveLiquidityImbalance":
-		s.reportLiquidityOperation(event, pool, true)
+		s.reportLiquidityOperation(event, pool, true, liquidityThreshold)
 	case "RemoveLiquidityOne":
-		// For RemoveLiquidityOne, there is no way to judge which coin is removed
-		// So we judge coin by the next Transfer event
-		pool.removeOneGot = true
-	case "Transfer":
-		if pool.removeOneGot {
-			pool.removeOneGot = false
-			tokenAmount, _ := new(big.Int).SetString(event.Result["value"], 10)
-			threshold := big.NewInt(config.Get().SUN.LiquidityThreshold)
-			tokenName := ""
-			if strings.Compare(event.Address, pool.coinsAddr[0]) == 0 {
-				// remove coin0
-				tokenAmount = misc.ConvertDecN(tokenAmount, pool.coinsDec[0])
-				tokenName = pool.coinsName[0]
-			} else {
-				// remove coin1
-				tokenAmount = misc.ConvertDecN(tokenAmount, pool.coinsDec[1])
-				tokenName = pool.coinsName[1]
-			}
-			if tokenAmount.Cmp(threshold) >= 0 {
-				msg := appendWarningIfNeeded(fmt.Sprintf("Large RemoveLiquidityOne, %s, %s, %s",
-					misc.FormatTokenAmt(tokenName, tokenAmount.Neg(tokenAmount), true),
-					misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
-					misc.FormatTxUrl(event.TransactionHash)), tokenName)
-				slack.SendMsg(s.topic, msg+" in `"+pool.name+"`")
+		if _, ok := event.Values["coin_index"]; ok {
+			coinIndex := int(event.BigInt("coin_index").Int64())
+			if coinIndex >= 0 && coinIndex < len(pool.coinsName) {
+				s.reportRemoveLiquidityOne(event, pool, coinIndex, event.BigInt("coin_amount"), liquidityThreshold)
+				return
 			}
 		}
+		// RemoveLiquidityOne without coin_index does not tell which coin is removed,
+		// judge it by the transfer out of the pool in the same tx
+		coinIndex, amount, err := pool.removedCoin(event.TransactionHash)
+		if err != nil {
+			misc.Warn(pool.name+".handleSwapSwapPoolEvent", fmt.Sprintf("tx=%s reason=\"judge removed coin: %s\"", event.TransactionHash, err.Error()))
+			return
+		}
+		s.reportRemoveLiquidityOne(event, pool, coinIndex, amount, liquidityThreshold)
 	case "RampA":
-		oldA, _ := new(big.Int).SetString(event.Result["old_A"], 10)
-		newA, _ := new(big.Int).SetString(event.Result["new_A"], 10)
-		slack.SendMsg(s.topic, "Ramp A from  `%d` => `%d`, %s in `%s`",
+		oldA, newA := event.BigInt("old_A"), event.BigInt("new_A")
+		alert.Send(s.topic, alert.Warning, "Ramp A from  `%d` => `%d`, %s in `%s`",
 			oldA, newA, misc.FormatTxUrl(event.TransactionHash), pool.name)
 	}
 }
 
-func (s *SUN) reportLiquidityOperation(event *net.Event, pool *pool, isRemove bool) {
-	tokenAmounts := strings.Split(event.Result["token_amounts"], "\n")
-	changedLiquidityOfCoin0, _ := new(big.Int).SetString(tokenAmounts[0], 10)
-	changedLiquidityOfCoin0 = misc.ConvertDecN(changedLiquidityOfCoin0, pool.coinsDec[0])
-	if isRemove {
-		changedLiquidityOfCoin0 = changedLiquidityOfCoin0.Neg(changedLiquidityOfCoin0)
+// removedCoin finds the coin transferred out of the pool by the tx and the amount transferred
+func (p *pool) removedCoin(txHash string) (int, *big.Int, error) {
+	logs, err := net.GetTxLogs(txHash)
+	if err != nil {
+		return 0, nil, err
+	}
+	decoder := abi.NewLogDecoder()
+	for _, log := range logs {
+		event := &net.Event{Address: misc.ToTronAddr(log.Address), TransactionHash: txHash}
+		if decoder.DecodeLog(log, event) != nil || event.EventName != "Transfer" || event.Addr("from") != p.addr {
+			continue
+		}
+		for i, coinAddr := range p.coinsAddr {
+			if event.Address == coinAddr {
+				return i, event.BigInt("value"), nil
+			}
+		}
 	}
-	changedLiquidityOfCoin1, _ := new(big.Int).SetString(tokenAmounts[1], 10)
-	changedLiquidityOfCoin1 = misc.ConvertDecN(changedLiquidityOfCoin1, pool.coinsDec[1])
-	if isRemove {
-		changedLiquidityOfCoin1 = changedLiquidityOfCoin1.Neg(changedLiquidityOfCoin1)
+	return 0, nil, fmt.Errorf("no coin transferred out of the pool")
+}
+
+func (s *SUN) reportRemoveLiquidityOne(event *net.Event, pool *pool, i int, amount *big.Int, threshold float64) {
+	tokenName := pool.coinsName[i]
+	tokenAmount := misc.ConvertDecN(amount, pool.coinsDec[i])
+	if usdValue, err := price.USD(tokenName, tokenAmount); err == nil && usdValue >= threshold {
+		msg := fmt.Sprintf("Large RemoveLiquidityOne, %s, %s, %s, %s",
+			misc.FormatTokenAmt(tokenName, tokenAmount.Neg(tokenAmount), true),
+			misc.FormatUSD(usdValue),
+			misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
+			misc.FormatTxUrl(event.TransactionHash))
+		alert.Send(s.topic, severityOfRemoved(tokenName), msg+" in `"+pool.name+"`")
+	}
+}
+
+func (s *SUN) reportLiquidityOperation(event *net.Event, pool *pool, isRemove bool, threshold float64) {
+	tokenAmounts := event.BigInts("token_amounts")
+	if len(tokenAmounts) != len(pool.coinsName) {
+		misc.Warn(pool.name+".reportLiquidityOperation", fmt.Sprintf("tx=%s reason=\"unexpected token_amounts\"", event.TransactionHash))
+		return
+	}
+	// coins without price are left out of the value, which is not judged if no coin has a price
+	usdValue, anyPriced, severity := 0.0, false, alert.Warning
+	changes := make([]string, len(tokenAmounts))
+	for i, amount := range tokenAmounts {
+		changedLiquidity := misc.ConvertDecN(amount, pool.coinsDec[i])
+		if isRemove {
+			changedLiquidity = changedLiquidity.Neg(changedLiquidity)
+		}
+		if value, err := price.USD(pool.coinsName[i], changedLiquidity); err == nil {
+			usdValue, anyPriced = usdValue+math.Abs(value), true
+		}
+		changes[i] = misc.FormatTokenAmt(pool.coinsName[i], changedLiquidity, true)
+		if changedLiquidity.Sign() < 0 && severityOfRemoved(pool.coinsName[i]) == alert.Critical {
+			severity = alert.Critical
+		}
 	}
-	threshold := big.NewInt(config.Get().SUN.LiquidityThreshold)
-	if changedLiquidityOfCoin0.CmpAbs(threshold) >= 0 || changedLiquidityOfCoin1.CmpAbs(threshold) >= 0 {
+	if anyPriced && usdValue >= threshold {
 		msg := fmt.Sprintf("Large %s, %s, %s, %s, %s",
 			event.EventName,
-			misc.FormatTokenAmt(pool.coinsName[0], changedLiquidityOfCoin0, true),
-			misc.FormatTokenAmt(pool.coinsName[1], changedLiquidityOfCoin1, true),
+			strings.Join(changes, ", "),
+			misc.FormatUSD(usdValue),
 			misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
 			misc.FormatTxUrl(event.TransactionHash))
-		if changedLiquidityOfCoin0.Cmp(big.NewInt(0)) < 0 && strings.Compare(pool.coinsName[0], "USDT") == 0 || changedLiquidityOfCoin1.Cmp(big.NewInt(0)) < 0 && strings.Compare(pool.coinsName[1], "USDT") == 0 {
-			msg = appendWarningIfNeeded(msg, "USDT")
-		}
-		slack.SendMsg(s.topic, msg+" in `"+pool.name+"`")
+		alert.Send(s.topic, severity, msg+" in `"+pool.name+"`")
 	}
 }
 
-func appendWarningIfNeeded(msg, tokenName string) string {
-	if strings.Compare("USDT", tokenName) == 0 {
-		// USDT has been token away from pool, we should add exclamation mark
-		msg = ":bangbang: " + msg
+// severityOfRemoved is the severity of taking the token away from a pool, critical for tokens in SUN.critical_tokens
+func severityOfRemoved(tokenName string) alert.Severity {
+	for _, token := range config.Get().SUN.CriticalTokens {
+		if strings.EqualFold(token, tokenName) {
+			return alert.Critical
+		}
 	}
-	return msg
+	return alert.Warning
 }
 
 func (s *SUN) init() {
+	initPoolPrices()
+	states, block := s.snapshot()
+	for name, v := range s.pools {
+		copy(v.cPoolBalances, states[name].balances)
+		copy(v.sPoolBalances, states[name].balances)
+	}
+	s.sBlock = block
 	s.report()
 }
 
+// snapshot reads states of all pools in one batch at the latest block, so that they are consistent
+func (s *SUN) snapshot() (map[string]*poolState, snapshotBlock) {
+	batch := multicall.New()
+	pickers := make(map[string]func(results *multicall.Results) *poolState)
+	for name, v := range s.pools {
+		pickers[name] = v.addQueries(batch)
+	}
+	results := batch.Do()
+	states := make(map[string]*poolState)
+	for name, pick := range pickers {
+		states[name] = pick(results)
+	}
+	return states, blockOf(results)
+}
+
 func (s *SUN) check() {
-	for _, v := range s.pools {
-		coin0PoolBalance, coin1PoolBalance := v.getPoolBalance(0), v.getPoolBalance(1)
-		diffCoin0 := big.NewInt(0)
-		diffCoin0 = diffCoin0.Sub(coin0PoolBalance, v.cPoolBalances[0])
-		diffCoin1 := big.NewInt(0)
-		diffCoin1 = diffCoin1.Sub(coin1PoolBalance, v.cPoolBalances[1])
-		reportThreshold := big.NewInt(config.Get().SUN.ReportThreshold)
-		if diffCoin0.CmpAbs(reportThreshold) >= 0 || diffCoin1.CmpAbs(reportThreshold) >= 0 {
-			slack.SendMsg(s.topic, "Large pool balance change in last `10min`, %s, %s in `%s`",
-				misc.FormatTokenAmt(v.coinsName[0], diffCoin0, true),
-				misc.FormatTokenAmt(v.coinsName[1], diffCoin1, true),
-				v.name)
-		}
-		v.cPoolBalances[0], v.cPoolBalances[1] = coin0PoolBalance, coin1PoolBalance
+	states, block := s.snapshot()
+	for _, name := range s.poolList {
+		v := s.pools[name]
+		_, _, reportThreshold := v.thresholds()
+		isLarge := false
+		diffs := make([]string, len(v.coinsName))
+		for i, balance := range states[name].balances {
+			diff := new(big.Int).Sub(balance, v.cPoolBalances[i])
+			if value, err := price.USD(v.coinsName[i], diff); err == nil && math.Abs(value) >= reportThreshold {
+				isLarge = true
+			}
+			diffs[i] = misc.FormatTokenAmt(v.coinsName[i], diff, true)
+		}
+		if isLarge {
+			alert.Send(s.topic, alert.Warning, "Large pool balance change in last `10min`, %s in `%s`, at %s",
+				strings.Join(diffs, ", "), v.name, block)
+		}
+		copy(v.cPoolBalances, states[name].balances)
+		s.checkDepeg(v, states[name], block)
 	}
+	prunePoolPrices()
 }
 
 func (s *SUN) report() {
-	for _, v := range s.pools {
-		coin0PoolBalance, coin1PoolBalance, curA := v.getPoolBalance(0), v.getPoolBalance(1), v.getA()
-		coin0Float64 := float64(coin0PoolBalance.Uint64())
-		coin1Float64 := float64(coin1PoolBalance.Uint64())
-		totalFloat64 := coin0Float64 + coin1Float64
-		var (
-			coin0Ratio float64
-			coin1Ratio float64
-			format     string
-		)
-		if coin0PoolBalance.Cmp(coin1PoolBalance) > 0 {
-			coin0Ratio = coin0Float64 / coin1Float64
-			coin1Ratio = 1.0
-			format = "`%.3f%%` : `%.3f%%` :curly_loop: `%.3f` : `%.0f`"
+	states, block := s.snapshot()
+	for _, name := range s.poolList {
+		v, state := s.pools[name], states[name]
+		balances := make([]string, len(state.balances))
+		for i, balance := range state.balances {
+			balances[i] = misc.FormatTokenAmt(v.coinsName[i], balance, false)
+		}
+		alert.Send(s.topic, alert.Info, "State Report, %s, A - `%d`, Ratio - %s in `%s`, at %s",
+			strings.Join(balances, ", "),
+			state.a,
+			formatRatio(state.balances),
+			v.name, block)
+		if msg, ok := s.reportDrift(v, state); ok {
+			alert.Send(s.topic, alert.Info, "%s in `%s`", msg, v.name)
+		}
+		copy(v.rPoolBalances, state.balances)
+		v.preA = state.a
+	}
+}
+
+// formatRatio shows shares of coins, and their ratios to the smallest one
+func formatRatio(balances []*big.Int) string {
+	floats, total, smallest := make([]float64, len(balances)), 0.0, 0
+	for i, balance := range balances {
+		floats[i], _ = new(big.Float).SetInt(balance).Float64()
+		total += floats[i]
+		if balances[i].Cmp(balances[smallest]) < 0 {
+			smallest = i
+		}
+	}
+	shares, ratios := make([]string, len(balances)), make([]string, len(balances))
+	for i := range floats {
+		shares[i] = fmt.Sprintf("`%.3f%%`", floats[i]*100/total)
+		if i == smallest {
+			ratios[i] = "`1`"
 		} else {
-			coin0Ratio = 1.0
-			coin1Ratio = coin1Float64 / coin0Float64
-			format = "`%.3f%%` : `%.3f%%` :curly_loop: `%.0f` : `%.3f`"
-		}
-		slack.SendMsg(s.topic, "State Report, %s, %s, A - `%d`, Ratio - "+format+" in `%s`",
-			misc.FormatTokenAmt(v.coinsName[0], coin0PoolBalance, false),
-			misc.FormatTokenAmt(v.coinsName[1], coin1PoolBalance, false),
-			curA,
-			coin0Float64*100/totalFloat64,
-			coin1Float64*100/totalFloat64,
-			coin0Ratio,
-			coin1Ratio,
-			v.name)
-		v.rPoolBalances[0], v.rPoolBalances[0], v.preA = coin0PoolBalance, coin1PoolBalance, curA
+			ratios[i] = fmt.Sprintf("`%.3f`", floats[i]/floats[smallest])
+		}
 	}
+	return strings.Join(shares, " : ") + " :curly_loop: " + strings.Join(ratios, " : ")
 }
 
 func (s *SUN) stats() {
-	for _, v := range s.pools {
-		coin0PoolBalance, coin1PoolBalance, now := v.getPoolBalance(0), v.getPoolBalance(1), time.Now()
-		slack.SendMsg(s.topic, "Stats Report, from `%s` ~ `%s`, %s, %s in `%s`",
+	states, block := s.snapshot()
+	now := time.Now()
+	for _, name := range s.poolList {
+		v := s.pools[name]
+		diffs := make([]string, len(v.coinsName))
+		for i, balance := range states[name].balances {
+			diffs[i] = misc.FormatTokenAmt(v.coinsName[i], new(big.Int).Sub(balance, v.sPoolBalances[i]), true)
+		}
+		alert.Send(s.topic, alert.Info, "Stats Report, from `%s` ~ `%s`, %s in `%s`, blocks %s ~ %s",
 			s.sTime.Format("15:04"), now.Format("15:04"),
-			misc.FormatTokenAmt(v.coinsName[0], v.sPoolBalances[0].Sub(coin0PoolBalance, v.sPoolBalances[0]), true),
-			misc.FormatTokenAmt(v.coinsName[1], v.sPoolBalances[1].Sub(coin1PoolBalance, v.sPoolBalances[1]), true),
-			v.name)
-		v.sPoolBalances[0], v.sPoolBalances[1] = coin0PoolBalance, coin1PoolBalance
+			strings.Join(diffs, ", "),
+			v.name, s.sBlock, block)
+		copy(v.sPoolBalances, states[name].balances)
 	}
-	s.sTime = time.Now()
+	s.sBlock, s.sTime = block, now
 }
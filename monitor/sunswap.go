@@ -0,0 +1,362 @@
+package monitor
+
+import (
+	"psm-monitor/abi"
+	"psm-monitor/alert"
+	"psm-monitor/config"
+	"psm-monitor/dispatcher"
+	"psm-monitor/misc"
+	"psm-monitor/multicall"
+	"psm-monitor/net"
+	"psm-monitor/price"
+
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+var (
+	token0Method      = abi.MustMethod("token0()", "address")
+	token1Method      = abi.MustMethod("token1()", "address")
+	getReservesMethod = abi.MustMethod("getReserves()", "uint112", "uint112", "uint32")
+	slot0Method       = abi.MustMethod("slot0()", "uint160", "int24", "uint16", "uint16", "uint16", "uint8", "bool")
+	liquidityMethod   = abi.MustMethod("liquidity()", "uint128")
+
+	// q96 is 2^96, the scale of sqrtPriceX96 of V3 pools
+	q96 = new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))
+)
+
+type pair struct {
+	name    string
+	addr    string
+	version int
+
+	tokensAddr [2]string
+	tokensName [2]string
+	tokensDec  [2]uint8
+
+	// check state for this pair
+	cState *pairState
+
+	// report state for this pair
+	rState *pairState
+
+	// stats state for this pair
+	sState *pairState
+
+	// prices of token0 in token1 before and after the last Sync or Swap, zero if unknown
+	prevPrice float64
+	lastPrice float64
+}
+
+// pairState is a snapshot of token reserves and the price of a pair
+type pairState struct {
+	reserves [2]*big.Int
+	// price of token0 in token1
+	price float64
+	// liquidity in range of a V3 pool, nil for V2 pairs
+	liquidity *big.Int
+}
+
+func (p *pair) init() {
+	for i, method := range []*abi.Method{token0Method, token1Method} {
+		if values, err := method.Call(p.addr); err == nil {
+			p.tokensAddr[i] = values[0].(string)
+		} else {
+			misc.Warn(p.name+".init", fmt.Sprintf("action=\"query token%d\" reason=\"%s\"", i, err.Error()))
+		}
+		p.tokensName[i] = abi.Name(p.tokensAddr[i])
+		p.tokensDec[i] = abi.Decimals(p.tokensAddr[i])
+	}
+}
+
+// toPrice converts raw amounts of token0 and token1 to the price of token0 in token1
+func (p *pair) toPrice(amount0, amount1 *big.Int) float64 {
+	if amount0.Sign() == 0 {
+		return 0
+	}
+	return toFloat(amount1, p.tokensDec[1]) / toFloat(amount0, p.tokensDec[0])
+}
+
+// sqrtPriceToPrice converts sqrtPriceX96 of a V3 pool to the price of token0 in token1
+func (p *pair) sqrtPriceToPrice(sqrtPriceX96 *big.Int) float64 {
+	sqrtPrice := new(big.Float).Quo(new(big.Float).SetInt(sqrtPriceX96), q96)
+	f, _ := new(big.Float).Mul(sqrtPrice, sqrtPrice).Float64()
+	return f * math.Pow10(int(p.tokensDec[0])-int(p.tokensDec[1]))
+}
+
+// usdValue sums USD values of raw amounts of both tokens, a token without price is left out so the sum is a lower bound,
+// it returns the error if neither token has a price
+func (p *pair) usdValue(amount0, amount1 *big.Int) (float64, error) {
+	value0, err0 := price.USDFloat(p.tokensName[0], toFloat(amount0, p.tokensDec[0]))
+	value1, err1 := price.USDFloat(p.tokensName[1], toFloat(amount1, p.tokensDec[1]))
+	if err0 != nil && err1 != nil {
+		return 0, err0
+	}
+	return math.Abs(value0) + math.Abs(value1), nil
+}
+
+// addQueries appends queries of the pair state to the batch, and returns a func picking the state from results
+func (p *pair) addQueries(batch *multicall.Batch) func(results *multicall.Results) *pairState {
+	if p.version == 2 {
+		idx := batch.Add(p.addr, getReservesMethod)
+		return func(results *multicall.Results) *pairState {
+			res := results.Results[idx]
+			if res.Err != nil {
+				misc.Warn(p.name+".getReserves", fmt.Sprintf("action=query reserves reason=\"%s\"", res.Err.Error()))
+				return p.cState
+			}
+			reserve0, reserve1 := res.Values[0].(*big.Int), res.Values[1].(*big.Int)
+			return &pairState{
+				reserves: [2]*big.Int{
+					misc.ConvertDecN(new(big.Int).Set(reserve0), p.tokensDec[0]),
+					misc.ConvertDecN(new(big.Int).Set(reserve1), p.tokensDec[1])},
+				price: p.toPrice(reserve0, reserve1),
+			}
+		}
+	}
+	slot0Idx := batch.Add(p.addr, slot0Method)
+	liquidityIdx := batch.Add(p.addr, liquidityMethod)
+	balanceIdx := [2]int{}
+	for i := range p.tokensAddr {
+		balanceIdx[i] = batch.Add(p.tokensAddr[i], abi.BalanceOfMethod, p.addr)
+	}
+	return func(results *multicall.Results) *pairState {
+		state := &pairState{}
+		if prev := p.cState; prev != nil {
+			*state = *prev
+		} else {
+			state.reserves = [2]*big.Int{big.NewInt(0), big.NewInt(0)}
+		}
+		if res := results.Results[slot0Idx]; res.Err == nil {
+			state.price = p.sqrtPriceToPrice(res.Values[0].(*big.Int))
+		} else {
+			misc.Warn(p.name+".slot0", fmt.Sprintf("action=query price reason=\"%s\"", res.Err.Error()))
+		}
+		if liquidity, err := results.Results[liquidityIdx].BigInt(); err == nil {
+			state.liquidity = liquidity
+		}
+		for i, idx := range balanceIdx {
+			if balance, err := results.Results[idx].BigInt(); err == nil {
+				state.reserves[i] = misc.ConvertDecN(balance, p.tokensDec[i])
+			} else {
+				// if we cannot get current token balance of the pool, use the c-value
+				misc.Warn(p.name+".balanceOf", fmt.Sprintf("action=query \"%s\" balance reason=\"%s\"", p.tokensName[i], err.Error()))
+			}
+		}
+		return state
+	}
+}
+
+type SunSwap struct {
+	topic string
+
+	// all tracked pairs, in the order of config
+	pairList []string
+	pairs    map[string]*pair
+	sBlock   snapshotBlock
+	sTime    time.Time
+}
+
+func StartSunSwap(c *cron.Cron, d *dispatcher.Dispatcher) {
+	sunSwap := &SunSwap{topic: ":sunio: [SunSwap]", sTime: time.Now()}
+
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" */10 * * * ?", misc.WrapLog(sunSwap.check))
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 0 */1 * * ?", misc.WrapLog(sunSwap.report))
+	_ = c.AddFunc(strconv.Itoa(int(rand.Uint32()%60))+" 30 */6 * * ?", misc.WrapLog(sunSwap.stats))
+
+	sunSwap.pairs = make(map[string]*pair)
+	for _, pc := range config.Get().SunSwap.Pairs {
+		if pc.Version != 2 && pc.Version != 3 {
+			misc.Warn("SunSwap.StartSunSwap", fmt.Sprintf("pair=%s reason=\"unknown version %d\", skip it", pc.Name, pc.Version))
+			continue
+		}
+		p := &pair{name: pc.Name, addr: pc.Address, version: pc.Version}
+		p.init()
+		sunSwap.pairList = append(sunSwap.pairList, pc.Name)
+		sunSwap.pairs[pc.Name] = p
+	}
+
+	confirmations := config.Get().SunSwap.Confirmations
+	for _, v := range sunSwap.pairs {
+		p := v
+		d.Subscribe("SunSwap."+p.name, p.addr, confirmations, func(event *net.Event) {
+			sunSwap.handlePairEvent(event, p)
+		})
+	}
+
+	sunSwap.init()
+}
+
+func (s *SunSwap) handlePairEvent(event *net.Event, p *pair) {
+	conf := config.Get().SunSwap
+	switch event.EventName {
+	case "Sync":
+		p.prevPrice, p.lastPrice = p.lastPrice, p.toPrice(event.BigInt("reserve0"), event.BigInt("reserve1"))
+	case "Swap":
+		var amount0, amount1 *big.Int
+		if p.version == 2 {
+			// Sync is emitted before Swap, so the price has been updated
+			amount0 = new(big.Int).Sub(event.BigInt("amount0In"), event.BigInt("amount0Out"))
+			amount1 = new(big.Int).Sub(event.BigInt("amount1In"), event.BigInt("amount1Out"))
+		} else {
+			amount0, amount1 = event.BigInt("amount0"), event.BigInt("amount1")
+			p.prevPrice, p.lastPrice = p.lastPrice, p.sqrtPriceToPrice(event.BigInt("sqrtPriceX96"))
+		}
+		// amounts are positive for the token sold into the pair
+		sold, bought := 0, 1
+		if amount0.Sign() < 0 {
+			sold, bought = 1, 0
+		}
+		amounts := [2]*big.Int{amount0, amount1}
+		soldAmount := toFloat(amounts[sold], p.tokensDec[sold])
+		boughtAmount := toFloat(new(big.Int).Neg(amounts[bought]), p.tokensDec[bought])
+		usdValue, err := price.USDFloat(p.tokensName[sold], soldAmount)
+		if err != nil {
+			usdValue, err = price.USDFloat(p.tokensName[bought], boughtAmount)
+		}
+		priced := err == nil
+		impact := 0.0
+		if p.prevPrice > 0 {
+			impact = (p.lastPrice/p.prevPrice - 1) * 100
+		}
+		isLarge := usdValue >= float64(conf.SwapThreshold)
+		isImpact := conf.PriceImpact > 0 && math.Abs(impact) >= conf.PriceImpact
+		if !isLarge && !isImpact {
+			return
+		}
+		// a swap alerted only for its price impact is not labeled large
+		label := "Large Swap"
+		if !isLarge {
+			label = "High Impact Swap"
+		}
+		msg := fmt.Sprintf("%s, %s => %s, %s, %s, impact - `%.3f%%`, %s",
+			label,
+			misc.FormatTokenFloat(p.tokensName[sold], soldAmount),
+			misc.FormatTokenFloat(p.tokensName[bought], boughtAmount),
+			misc.FormatValue(usdValue, priced),
+			misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
+			impact,
+			misc.FormatTxUrl(event.TransactionHash))
+		severity := alert.Warning
+		if isImpact {
+			severity = alert.Critical
+		}
+		alert.Send(s.topic, severity, msg+" in `"+p.name+"`")
+	case "Mint", "Burn", "Collect":
+		amount0, amount1 := event.BigInt("amount0"), event.BigInt("amount1")
+		if usdValue, err := p.usdValue(amount0, amount1); err == nil && usdValue >= float64(conf.LiquidityThreshold) {
+			alert.Send(s.topic, alert.Warning, "Large %s, %s, %s, %s, %s, %s in `%s`",
+				event.EventName,
+				misc.FormatTokenFloat(p.tokensName[0], toFloat(amount0, p.tokensDec[0])),
+				misc.FormatTokenFloat(p.tokensName[1], toFloat(amount1, p.tokensDec[1])),
+				misc.FormatUSD(usdValue),
+				misc.FormatUser(net.GetTxFrom(event.TransactionHash)),
+				misc.FormatTxUrl(event.TransactionHash),
+				p.name)
+		}
+	}
+}
+
+func (s *SunSwap) init() {
+	states, block := s.snapshot()
+	for name, v := range s.pairs {
+		v.cState, v.sState = states[name], states[name]
+		v.lastPrice = states[name].price
+	}
+	s.sBlock = block
+	s.report()
+}
+
+// snapshot reads states of all pairs in one batch at the latest block, so that they are consistent
+func (s *SunSwap) snapshot() (map[string]*pairState, snapshotBlock) {
+	batch := multicall.New()
+	pickers := make(map[string]func(results *multicall.Results) *pairState)
+	for name, v := range s.pairs {
+		pickers[name] = v.addQueries(batch)
+	}
+	results := batch.Do()
+	states := make(map[string]*pairState)
+	for name, pick := range pickers {
+		state := pick(results)
+		if state == nil {
+			state = &pairState{reserves: [2]*big.Int{big.NewInt(0), big.NewInt(0)}}
+		}
+		states[name] = state
+	}
+	return states, blockOf(results)
+}
+
+func (s *SunSwap) check() {
+	conf := config.Get().SunSwap
+	states, block := s.snapshot()
+	for _, name := range s.pairList {
+		v, state := s.pairs[name], states[name]
+		diff0 := new(big.Int).Sub(state.reserves[0], v.cState.reserves[0])
+		diff1 := new(big.Int).Sub(state.reserves[1], v.cState.reserves[1])
+		// a token without price is left out, the check is skipped if neither token has a price
+		value0, err0 := price.USD(v.tokensName[0], diff0)
+		value1, err1 := price.USD(v.tokensName[1], diff1)
+		if (err0 == nil || err1 == nil) && math.Abs(value0)+math.Abs(value1) >= float64(conf.ReportThreshold) {
+			alert.Send(s.topic, alert.Warning, "Large reserve change in last `10min`, %s, %s in `%s`, at %s",
+				misc.FormatTokenAmt(v.tokensName[0], diff0, true),
+				misc.FormatTokenAmt(v.tokensName[1], diff1, true),
+				v.name, block)
+		}
+		if v.cState.price > 0 && state.price > 0 && conf.PriceImpact > 0 {
+			if move := (state.price/v.cState.price - 1) * 100; math.Abs(move) >= conf.PriceImpact {
+				alert.Send(s.topic, alert.Critical, "Large price move in last `10min`, %s => `%s` %s, `%+.3f%%` in `%s`, at %s",
+					v.formatPrice(v.cState.price), misc.ToReadableFloat(state.price, 6), v.tokensName[1],
+					move, v.name, block)
+			}
+		}
+		v.cState = state
+	}
+}
+
+func (s *SunSwap) report() {
+	states, block := s.snapshot()
+	for _, name := range s.pairList {
+		v, state := s.pairs[name], states[name]
+		msg := fmt.Sprintf("State Report, %s, %s, %s",
+			misc.FormatTokenAmt(v.tokensName[0], state.reserves[0], false),
+			misc.FormatTokenAmt(v.tokensName[1], state.reserves[1], false),
+			v.formatPrice(state.price))
+		if state.liquidity != nil {
+			msg += fmt.Sprintf(", Liquidity - `%s`", misc.ToReadableDec(state.liquidity))
+		}
+		if v.rState != nil && v.rState.price > 0 && state.price > 0 {
+			msg += fmt.Sprintf(", `%+.3f%%` in last `1h`", (state.price/v.rState.price-1)*100)
+		}
+		alert.Send(s.topic, alert.Info, "%s in `%s`, at %s", msg, v.name, block)
+		v.rState = state
+	}
+}
+
+func (s *SunSwap) stats() {
+	states, block := s.snapshot()
+	now := time.Now()
+	for _, name := range s.pairList {
+		v, state := s.pairs[name], states[name]
+		msg := fmt.Sprintf("Stats Report, from `%s` ~ `%s`, %s, %s",
+			s.sTime.Format("15:04"), now.Format("15:04"),
+			misc.FormatTokenAmt(v.tokensName[0], new(big.Int).Sub(state.reserves[0], v.sState.reserves[0]), true),
+			misc.FormatTokenAmt(v.tokensName[1], new(big.Int).Sub(state.reserves[1], v.sState.reserves[1]), true))
+		if v.sState.price > 0 && state.price > 0 {
+			msg += fmt.Sprintf(", price `%+.3f%%`", (state.price/v.sState.price-1)*100)
+		}
+		alert.Send(s.topic, alert.Info, "%s in `%s`, blocks %s ~ %s", msg, v.name, s.sBlock, block)
+		v.sState = state
+	}
+	s.sBlock, s.sTime = block, now
+}
+
+// formatPrice shows the price of token0 in token1
+func (p *pair) formatPrice(f float64) string {
+	return fmt.Sprintf("Price - `1` %s = `%s` %s", p.tokensName[0], misc.ToReadableFloat(f, 6), p.tokensName[1])
+}
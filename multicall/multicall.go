@@ -0,0 +1,270 @@
+package multicall
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"psm-monitor/abi"
+	"psm-monitor/config"
+	"psm-monitor/misc"
+	"psm-monitor/net"
+)
+
+// maxParallelCalls bounds the individual calls in flight when no multicall contract is used
+const maxParallelCalls = 8
+
+var ErrCallFailed = errors.New("multicall: call failed")
+
+var tryBlockAndAggregateMethod = abi.MustMethod("tryBlockAndAggregate(bool,(address,bytes)[])",
+	"uint256", "bytes32", "(bool,bytes)[]")
+
+type call struct {
+	addr   string
+	method *abi.Method
+	args   []interface{}
+}
+
+// Result is the outcome of one call in the batch
+type Result struct {
+	Values []interface{}
+	Err    error
+}
+
+func (r *Result) Success() bool {
+	return r.Err == nil
+}
+
+// BigInt returns the first return value as integer
+func (r *Result) BigInt() (*big.Int, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if v, ok := r.Values[0].(*big.Int); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("multicall: returns %T, not integer", r.Values[0])
+}
+
+// Results are outcomes of all calls in the batch, in the order they are added
+type Results struct {
+	// BlockNumber is the block all calls are executed at, zero if unknown
+	BlockNumber uint64
+	// Pinned tells whether all calls are guaranteed to be executed at BlockNumber,
+	// otherwise BlockNumber is just the latest block when the calls are made
+	Pinned  bool
+	Results []*Result
+}
+
+// Batch aggregates constant calls into one invocation of the multicall contract
+type Batch struct {
+	calls []*call
+}
+
+func New() *Batch {
+	return &Batch{}
+}
+
+// Add appends the call to the batch and returns its index in Results
+func (b *Batch) Add(addr string, method *abi.Method, args ...interface{}) int {
+	b.calls = append(b.calls, &call{addr: addr, method: method, args: args})
+	return len(b.calls) - 1
+}
+
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// pinning states of the node, whether it executes eth_call at a given block is detected by the first pinned calls
+const (
+	pinningUnknown = iota
+	pinningSupported
+	pinningUnsupported
+)
+
+// pinningRecheck is how long the node is trusted not to support pinned calls before probing it again
+const pinningRecheck = time.Hour
+
+var (
+	pinning     = pinningUnknown
+	pinnedAt    time.Time
+	pinningLock sync.Mutex
+)
+
+func canPin() bool {
+	pinningLock.Lock()
+	defer pinningLock.Unlock()
+	if pinning == pinningUnsupported && time.Since(pinnedAt) > pinningRecheck {
+		pinning = pinningUnknown
+	}
+	return pinning != pinningUnsupported
+}
+
+func setPinning(state int) {
+	pinningLock.Lock()
+	defer pinningLock.Unlock()
+	if pinning == pinningUnknown {
+		pinning, pinnedAt = state, time.Now()
+		misc.Info("Multicall report", fmt.Sprintf("pinned calls supported=%t", state == pinningSupported))
+	}
+}
+
+// rejected tells whether the node answered the call with an error, transport failures say nothing about pinning
+func rejected(err error) bool {
+	var rpcErr *net.JsonRpcError
+	return errors.As(err, &rpcErr)
+}
+
+// Do executes all calls at the latest block, see DoAt
+func (b *Batch) Do() *Results {
+	if len(b.calls) == 0 {
+		return &Results{Results: []*Result{}}
+	}
+	if !canPin() {
+		return b.DoAt(0)
+	}
+	return b.DoAt(net.BlockNumber())
+}
+
+// DoAt executes all calls at the given block via eth_call, calls are aggregated via the multicall contract configured,
+// or made individually in parallel if there is no multicall contract or the aggregated call fails,
+// if the node turns out not to support querying the block, following calls are made at the latest state until it is probed again
+func (b *Batch) DoAt(blockNumber uint64) *Results {
+	if len(b.calls) == 0 {
+		return &Results{BlockNumber: blockNumber, Pinned: blockNumber != 0, Results: []*Result{}}
+	}
+	pin := blockNumber != 0 && canPin()
+	if addr := config.Get().Multicall; len(addr) > 0 {
+		// the node rejects the block only if it answers the pinned call with an error but not the same one at the latest
+		pinRejected := false
+		if pin {
+			results, err := b.aggregate(addr, blockNumber)
+			if err == nil {
+				setPinning(pinningSupported)
+				return results
+			}
+			pinRejected = rejected(err)
+			misc.Warn("Multicall report", fmt.Sprintf("action=\"aggregate %d calls at block %d\" reason=\"%s\", fallback to the latest block", len(b.calls), blockNumber, err.Error()))
+		}
+		results, err := b.aggregate(addr, 0)
+		if err == nil {
+			if pinRejected {
+				setPinning(pinningUnsupported)
+			}
+			return results
+		}
+		misc.Warn("Multicall report", fmt.Sprintf("action=\"aggregate %d calls\" reason=\"%s\", fallback to individual calls", len(b.calls), err.Error()))
+	}
+	pinRejected := false
+	if pin {
+		// a single reverted call does not mean the block cannot be queried, only a batch without any success does
+		results := b.parallel(blockNumber)
+		if results.anySucceeded() {
+			setPinning(pinningSupported)
+			return results
+		}
+		pinRejected = results.allRejected()
+		misc.Warn("Multicall report", fmt.Sprintf("action=\"call %d calls at block %d\" reason=\"all calls failed\", fallback to the latest block", len(b.calls), blockNumber))
+	}
+	latest := net.BlockNumber()
+	results := b.parallel(0)
+	if pinRejected && results.anySucceeded() {
+		setPinning(pinningUnsupported)
+	}
+	// calls at the latest state are not pinned, they are made around the latest block
+	results.BlockNumber, results.Pinned = latest, false
+	return results
+}
+
+// aggregate calls the multicall contract at the given block, zero block number means triggering at the latest state
+func (b *Batch) aggregate(addr string, blockNumber uint64) (*Results, error) {
+	calls := make([]interface{}, len(b.calls))
+	for i, c := range b.calls {
+		data, err := c.method.Pack(c.args...)
+		if err != nil {
+			return nil, err
+		}
+		calls[i] = []interface{}{c.addr, append(c.method.Selector(), data...)}
+	}
+	var (
+		values []interface{}
+		err    error
+	)
+	if blockNumber != 0 {
+		values, err = tryBlockAndAggregateMethod.CallAt(addr, blockNumber, false, calls)
+	} else {
+		values, err = tryBlockAndAggregateMethod.Call(addr, false, calls)
+	}
+	if err != nil {
+		return nil, err
+	}
+	returns, ok := values[2].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("multicall: returns %T, not call results", values[2])
+	}
+	if len(returns) != len(b.calls) {
+		return nil, fmt.Errorf("multicall: %d calls but %d returns", len(b.calls), len(returns))
+	}
+	// all calls in one multicall invocation are executed at the block it returns
+	results := &Results{BlockNumber: values[0].(*big.Int).Uint64(), Pinned: true, Results: make([]*Result, len(b.calls))}
+	for i, ret := range returns {
+		fields := ret.([]interface{})
+		result := &Result{}
+		if success := fields[0].(bool); !success {
+			result.Err = ErrCallFailed
+		} else {
+			result.Values, result.Err = b.calls[i].method.Unpack(fields[1].([]byte))
+		}
+		results.Results[i] = result
+	}
+	return results, nil
+}
+
+// parallel makes individual calls in parallel at the given block, zero block number means triggering at the latest state
+func (b *Batch) parallel(blockNumber uint64) *Results {
+	results := &Results{BlockNumber: blockNumber, Pinned: blockNumber != 0, Results: make([]*Result, len(b.calls))}
+	sem := make(chan struct{}, maxParallelCalls)
+	var wg sync.WaitGroup
+	for i, c := range b.calls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c *call) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var (
+				values []interface{}
+				err    error
+			)
+			if blockNumber != 0 {
+				values, err = c.method.CallAt(c.addr, blockNumber, c.args...)
+			} else {
+				values, err = c.method.Call(c.addr, c.args...)
+			}
+			results.Results[i] = &Result{Values: values, Err: err}
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Results) anySucceeded() bool {
+	for _, result := range r.Results {
+		if result.Success() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Results) allRejected() bool {
+	for _, result := range r.Results {
+		if !rejected(result.Err) {
+			return false
+		}
+	}
+	return true
+}
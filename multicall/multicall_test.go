@@ -0,0 +1,27 @@
+package multicall
+
+import (
+	"fmt"
+	"testing"
+
+	"psm-monitor/net"
+)
+
+func TestEmptyBatch(t *testing.T) {
+	results := New().DoAt(100)
+	if len(results.Results) != 0 || results.BlockNumber != 100 || !results.Pinned {
+		t.Fatalf("empty batch at block 100 returns %+v", results)
+	}
+	if results := New().Do(); len(results.Results) != 0 {
+		t.Fatalf("empty batch returns %d results", len(results.Results))
+	}
+}
+
+func TestRejected(t *testing.T) {
+	if !rejected(fmt.Errorf("eth_call: %w", &net.JsonRpcError{Code: -32602, Message: "invalid block"})) {
+		t.Fatal("node error is not taken as rejection")
+	}
+	if rejected(net.ErrHttpFailed) || rejected(ErrCallFailed) {
+		t.Fatal("transport or call failure is taken as rejection")
+	}
+}
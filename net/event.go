@@ -0,0 +1,58 @@
+package net
+
+import (
+	"math/big"
+)
+
+// BigInt returns a copy of the integer value, zero if it is absent
+func (e *Event) BigInt(name string) *big.Int {
+	if v, ok := e.Values[name].(*big.Int); ok {
+		return new(big.Int).Set(v)
+	}
+	return big.NewInt(0)
+}
+
+// BigInts returns copies of the integer array value, nil if it is absent
+func (e *Event) BigInts(name string) []*big.Int {
+	v, ok := e.Values[name].([]*big.Int)
+	if !ok {
+		return nil
+	}
+	values := make([]*big.Int, len(v))
+	for i := range v {
+		values[i] = new(big.Int).Set(v[i])
+	}
+	return values
+}
+
+// Addr returns the address value in base58 form, empty if it is absent
+func (e *Event) Addr(name string) string {
+	if v, ok := e.Values[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Bool returns the bool value, false if it is absent
+func (e *Event) Bool(name string) bool {
+	if v, ok := e.Values[name].(bool); ok {
+		return v
+	}
+	return false
+}
+
+// Bytes returns the bytes value, nil if it is absent
+func (e *Event) Bytes(name string) []byte {
+	if v, ok := e.Values[name].([]byte); ok {
+		return v
+	}
+	return nil
+}
+
+// Text returns the string value, empty if it is absent
+func (e *Event) Text(name string) string {
+	if v, ok := e.Values[name].(string); ok {
+		return v
+	}
+	return ""
+}
@@ -11,6 +11,7 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -24,16 +25,23 @@ import (
 )
 
 const (
-	TriggerPath      = "wallet/triggerconstantcontract"
-	ParametersPath   = "wallet/getchainparameters"
-	BlockEventsPath  = "v1/blocks/%d/events?limit=200"
-	LatestEventsPath = "v1/blocks/latest/events?limit=200"
+	TriggerPath    = "wallet/triggerconstantcontract"
+	ParametersPath = "wallet/getchainparameters"
+	BlockPath      = "wallet/getblock"
 )
 
 var ErrHttpFailed = errors.New("net: http request failed")
 var ErrNoReturn = errors.New("net: no return data")
 var ErrQueryFailed = errors.New("net: query failed")
 
+// secretPattern matches secrets in urls of notification channels, the telegram bot token and webhook paths
+var secretPattern = regexp.MustCompile(`(/bot)[^/]+|(hooks\.slack\.com/services/|discord(?:app)?\.com/api/webhooks/)[^?\s"]+`)
+
+// redact hides secrets in the url or the error message containing it, so that they are not logged
+func redact(s string) string {
+	return secretPattern.ReplaceAllString(s, "$1$2<redacted>")
+}
+
 var dialer = net.Dialer{
 	Timeout:   30 * time.Second,
 	KeepAlive: 30 * time.Second,
@@ -82,6 +90,53 @@ func CallJsonRpc(method string, params []byte) ([]byte, error) {
 	}
 }
 
+// CallJsonRpcRaw calls the json rpc method with structured params and returns the raw result
+func CallJsonRpcRaw(method string, params ...interface{}) (json.RawMessage, error) {
+	if params == nil {
+		params = make([]interface{}, 0)
+	}
+	data, err := Post(config.Get().EventServer+"jsonrpc", &JsonRpcRequest{
+		Version: "2.0",
+		ID:      233,
+		Method:  method,
+		Params:  params,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rspMsg JsonRpcResponse
+	if err := json.Unmarshal(data, &rspMsg); err != nil {
+		return nil, err
+	}
+	if rspMsg.Error != nil {
+		return nil, rspMsg.Error
+	}
+	return rspMsg.Result, nil
+}
+
+// EthCall calls the contract at the given block via json rpc, zero block number means the latest block
+func EthCall(addr string, data []byte, blockNumber uint64) ([]byte, error) {
+	blockTag := "latest"
+	if blockNumber != 0 {
+		blockTag = "0x" + strconv.FormatUint(blockNumber, 16)
+	}
+	result, err := CallJsonRpcRaw("eth_call", &CallMsg{
+		To:   "0x" + misc.ToEthAddr(addr)[24:],
+		Data: hexutil.Encode(data),
+	}, blockTag)
+	if err != nil {
+		return nil, err
+	}
+	var hexData string
+	if err := json.Unmarshal(result, &hexData); err != nil {
+		return nil, err
+	}
+	if len(hexData) <= 2 {
+		return nil, ErrNoReturn
+	}
+	return hexutil.Decode(hexData)
+}
+
 func BlockNumber() uint64 {
 	if resData, resErr := CallJsonRpc("eth_blockNumber", nil); resErr == nil {
 		return new(big.Int).SetBytes(resData).Uint64()
@@ -96,9 +151,12 @@ func GetPrice(token string) float64 {
 		return 0
 	}
 
-	priceStr := gojsonq.New().FromString(string(result)).Find("data." + token + ".quote.USD.price")
+	priceStr, ok := gojsonq.New().FromString(string(result)).Find("data." + token + ".quote.USD.price").(string)
+	if !ok {
+		return 0
+	}
 
-	price, err := strconv.ParseFloat(priceStr.(string), 64)
+	price, err := strconv.ParseFloat(priceStr, 64)
 	if err != nil {
 		return 0
 	}
@@ -130,29 +188,22 @@ func GetEnergyPriceAndFactor() (float64, float64) {
 	return parameters[11].(map[string]interface{})["value"].(float64), parameters[62].(map[string]interface{})["value"].(float64)
 }
 
-func GetBlockEvents(blockNumber uint64) []*Event {
-	return getEvents(config.Get().EventServer + fmt.Sprintf(BlockEventsPath, blockNumber))
-}
-
-func GetLatestBlockEvents() []*Event {
-	return getEvents(config.Get().EventServer + LatestEventsPath)
-}
-
-func getEvents(url string) []*Event {
-	allEvents := make([]*Event, 0)
-	events := Events{}
-	events.Meta.Links.Next = url
-	for len(events.Meta.Links.Next) != 0 {
-		rspData, err := Get(events.Meta.Links.Next, nil)
-		if err != nil {
-			break
-		}
-		events = Events{}
-		if err := json.Unmarshal(rspData, &events); err == nil {
-			allEvents = append(allEvents, events.Data...)
-		}
+func GetBlock(blockNumber uint64) (*Block, error) {
+	resData, err := Post(config.Get().FullNode+BlockPath, BlockRequest{
+		IdOrNum: strconv.FormatUint(blockNumber, 10),
+		Detail:  false,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var block Block
+	if err := json.Unmarshal(resData, &block); err != nil {
+		return nil, err
+	}
+	if len(block.BlockID) == 0 {
+		return nil, ErrNoReturn
 	}
-	return allEvents
+	return &block, nil
 }
 
 func GetTxFrom(id string) string {
@@ -205,13 +256,13 @@ func Post(url string, d interface{}, chkFn func([]byte) error) ([]byte, error) {
 func doRequestWithRetry(req *http.Request, body []byte, chkFn func([]byte) error) ([]byte, error) {
 	reqId := rand.Uint32()
 	title := "Http request report"
-	misc.Info(title, fmt.Sprintf("url=%s method=%s data=%s reqid=%d", req.URL, req.Method, string(body), reqId))
+	misc.Info(title, fmt.Sprintf("url=%s method=%s data=%s reqid=%d", redact(req.URL.String()), req.Method, string(body), reqId))
 	for i := 1; i <= 3; i++ {
 		startAt := time.Now()
 		retRes, retErr := defaultHTTPClient.Do(req)
 		cost := time.Now().Sub(startAt).Milliseconds()
 		var chkErr error
-		if retErr == nil && retRes.StatusCode == 200 {
+		if retErr == nil && retRes.StatusCode >= 200 && retRes.StatusCode < 300 {
 			if body, ioErr := io.ReadAll(retRes.Body); ioErr == nil {
 				_ = retRes.Body.Close()
 				if chkFn != nil {
@@ -225,7 +276,7 @@ func doRequestWithRetry(req *http.Request, body []byte, chkFn func([]byte) error
 			_ = retRes.Body.Close()
 		}
 		if retErr != nil {
-			misc.Debug(title, fmt.Sprintf("status=retry reqid=%d cost=%dms times=%dth reason=\"%s\"", reqId, cost, i, retErr.Error()))
+			misc.Debug(title, fmt.Sprintf("status=retry reqid=%d cost=%dms times=%dth reason=\"%s\"", reqId, cost, i, redact(retErr.Error())))
 		} else if chkErr != nil {
 			misc.Debug(title, fmt.Sprintf("status=retry reqid=%d cost=%dms times=%dth reason=\"%s\"", reqId, cost, i, chkErr.Error()))
 		} else {
@@ -10,3 +10,18 @@ func TestGetTxFrom(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRedact(t *testing.T) {
+	cases := map[string]string{
+		"https://api.telegram.org/bot123:ABC/sendMessage":           "https://api.telegram.org/bot<redacted>/sendMessage",
+		"https://hooks.slack.com/services/T000/B000/XXXX":           "https://hooks.slack.com/services/<redacted>",
+		"https://discord.com/api/webhooks/1/abc?wait=true":          "https://discord.com/api/webhooks/<redacted>?wait=true",
+		"https://api.trongrid.io/v1/blocks/1/events?limit=200":      "https://api.trongrid.io/v1/blocks/1/events?limit=200",
+		`Post "https://api.telegram.org/bot123:ABC/sendMessage": x`: `Post "https://api.telegram.org/bot<redacted>/sendMessage": x`,
+	}
+	for s, want := range cases {
+		if got := redact(s); got != want {
+			t.Fatalf("redact(%s) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"psm-monitor/config"
+	"psm-monitor/misc"
+)
+
+const (
+	BlockEventsPath = "v1/blocks/%d/events?limit=200"
+	TxInfoPath      = "wallet/gettransactioninfobyblocknum"
+	TxInfoByIdPath  = "wallet/gettransactioninfobyid"
+)
+
+var ErrUnknownEvent = errors.New("net: unknown event")
+
+// EventSource provides contract events of a fetched block, in the order they are emitted
+type EventSource interface {
+	GetBlockEvents(block *Block) ([]*Event, error)
+}
+
+// LogDecoder decodes events into typed Values
+type LogDecoder interface {
+	// DecodeLog fills EventName, Event, Result and Values of the event by decoding the raw log,
+	// it returns ErrUnknownEvent if the log cannot be recognized
+	DecodeLog(log *Log, event *Event) error
+	// DecodeResult fills Values of the event by typing the Result rendered by event server
+	DecodeResult(event *Event) error
+}
+
+var (
+	source     EventSource = &TronGridSource{}
+	sourceLock sync.RWMutex
+)
+
+// SetEventSource replaces the source used by GetBlockEvents, TronGrid without decoder is used by default,
+// so events have no typed Values until a source with decoder is set
+func SetEventSource(s EventSource) {
+	sourceLock.Lock()
+	defer sourceLock.Unlock()
+	source = s
+}
+
+func GetBlockEvents(block *Block) ([]*Event, error) {
+	sourceLock.RLock()
+	s := source
+	sourceLock.RUnlock()
+	return s.GetBlockEvents(block)
+}
+
+// TronGridSource queries events from TronGrid compatible event server
+type TronGridSource struct {
+	decoder LogDecoder
+}
+
+func NewTronGridSource(decoder LogDecoder) *TronGridSource {
+	return &TronGridSource{decoder: decoder}
+}
+
+func (s *TronGridSource) GetBlockEvents(block *Block) ([]*Event, error) {
+	events, err := getEvents(config.Get().EventServer + fmt.Sprintf(BlockEventsPath, block.BlockHeader.RawData.Number))
+	if err != nil || s.decoder == nil {
+		return events, err
+	}
+	for _, event := range events {
+		if err := s.decoder.DecodeResult(event); err != nil {
+			misc.Warn("TronGrid source", fmt.Sprintf("tx=%s event=%s reason=\"%s\"", event.TransactionHash, event.EventName, err.Error()))
+		}
+	}
+	return events, nil
+}
+
+// GetTxLogs returns raw logs emitted by the transaction, queried from the full node
+func GetTxLogs(id string) ([]*Log, error) {
+	resData, err := Post(config.Get().FullNode+TxInfoByIdPath, TxIdRequest{Value: id}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var info TransactionInfo
+	if err := json.Unmarshal(resData, &info); err != nil {
+		return nil, err
+	}
+	if len(info.ID) == 0 {
+		return nil, ErrNoReturn
+	}
+	return info.Log, nil
+}
+
+func getEvents(url string) ([]*Event, error) {
+	allEvents := make([]*Event, 0)
+	events := Events{}
+	events.Meta.Links.Next = url
+	for len(events.Meta.Links.Next) != 0 {
+		rspData, err := Get(events.Meta.Links.Next, nil)
+		if err != nil {
+			return allEvents, err
+		}
+		events = Events{}
+		if err := json.Unmarshal(rspData, &events); err != nil {
+			return allEvents, err
+		}
+		allEvents = append(allEvents, events.Data...)
+	}
+	return allEvents, nil
+}
+
+// FullNodeSource derives events from transaction logs of a full node without event plugin
+type FullNodeSource struct {
+	decoder LogDecoder
+}
+
+func NewFullNodeSource(decoder LogDecoder) *FullNodeSource {
+	return &FullNodeSource{decoder: decoder}
+}
+
+func (s *FullNodeSource) GetBlockEvents(block *Block) ([]*Event, error) {
+	resData, err := Post(config.Get().FullNode+TxInfoPath, BlockNumRequest{Num: block.BlockHeader.RawData.Number}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var infos []*TransactionInfo
+	if string(bytes.TrimSpace(resData)) == "{}" {
+		// the node responds an empty object for blocks without transactions
+		return make([]*Event, 0), nil
+	}
+	if err := json.Unmarshal(resData, &infos); err != nil {
+		return nil, err
+	}
+	events := make([]*Event, 0)
+	for _, info := range infos {
+		for i, log := range info.Log {
+			event := &Event{
+				BlockNumber:     info.BlockNumber,
+				BlockTimestamp:  info.BlockTimeStamp,
+				Address:         misc.ToTronAddr(log.Address),
+				LogIndex:        uint(i),
+				TransactionHash: info.ID,
+			}
+			if err := s.decoder.DecodeLog(log, event); err != nil {
+				if err != ErrUnknownEvent {
+					misc.Debug("Full node source", fmt.Sprintf("tx=%s index=%d reason=\"%s\"", info.ID, i, err.Error()))
+				}
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// JsonRpcSource queries logs via eth_getLogs, only logs of subscribed addresses with known topics are downloaded
+type JsonRpcSource struct {
+	decoder   LogDecoder
+	addresses func() []string
+	topics    []string
+}
+
+// NewJsonRpcSource creates the source, addresses is called on every query so that
+// subscriptions changed at runtime are respected, topics are hex encoded topic0 of concerned events
+func NewJsonRpcSource(decoder LogDecoder, addresses func() []string, topics []string) *JsonRpcSource {
+	return &JsonRpcSource{decoder: decoder, addresses: addresses, topics: topics}
+}
+
+func (s *JsonRpcSource) GetBlockEvents(block *Block) ([]*Event, error) {
+	blockNumber := block.BlockHeader.RawData.Number
+	addrs := s.addresses()
+	if len(addrs) == 0 {
+		return make([]*Event, 0), nil
+	}
+	filter := &LogFilter{
+		FromBlock: "0x" + strconv.FormatUint(blockNumber, 16),
+		ToBlock:   "0x" + strconv.FormatUint(blockNumber, 16),
+		Address:   make([]string, len(addrs)),
+	}
+	for i, addr := range addrs {
+		filter.Address[i] = "0x" + misc.ToEthAddr(addr)[24:]
+	}
+	if len(s.topics) > 0 {
+		filter.Topics = [][]string{s.topics}
+	}
+	result, err := CallJsonRpcRaw("eth_getLogs", filter)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*JsonRpcLog
+	if err := json.Unmarshal(result, &logs); err != nil {
+		return nil, err
+	}
+	events := make([]*Event, 0, len(logs))
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		logIndex, _ := strconv.ParseUint(strings.TrimPrefix(log.LogIndex, "0x"), 16, 64)
+		event := &Event{
+			BlockNumber:     blockNumber,
+			BlockTimestamp:  block.BlockHeader.RawData.Timestamp,
+			Address:         misc.ToTronAddr(log.Address),
+			LogIndex:        uint(logIndex),
+			TransactionHash: strings.TrimPrefix(log.TransactionHash, "0x"),
+		}
+		raw := &Log{Address: log.Address, Topics: log.Topics, Data: log.Data}
+		if err := s.decoder.DecodeLog(raw, event); err != nil {
+			if err != ErrUnknownEvent {
+				misc.Debug("Json rpc source", fmt.Sprintf("tx=%s index=%d reason=\"%s\"", event.TransactionHash, logIndex, err.Error()))
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].LogIndex < events[j].LogIndex })
+	return events, nil
+}
@@ -1,5 +1,10 @@
 package net
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type TriggerRequest struct {
 	OwnerAddress     string `json:"owner_address"`
 	ContractAddress  string `json:"contract_address"`
@@ -24,6 +29,53 @@ type JsonRpcMessage struct {
 	Result  string `json:"result,omitempty"`
 }
 
+type JsonRpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type JsonRpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Error   *JsonRpcError   `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type JsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *JsonRpcError) Error() string {
+	return fmt.Sprintf("net: json rpc error %d, %s", e.Code, e.Message)
+}
+
+type CallMsg struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+type LogFilter struct {
+	FromBlock string     `json:"fromBlock"`
+	ToBlock   string     `json:"toBlock"`
+	Address   []string   `json:"address,omitempty"`
+	Topics    [][]string `json:"topics,omitempty"`
+}
+
+type JsonRpcLog struct {
+	Address         string   `json:"address"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	LogIndex        string   `json:"logIndex"`
+	TransactionHash string   `json:"transactionHash"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	Removed         bool     `json:"removed"`
+}
+
 type Event struct {
 	BlockNumber     uint64            `json:"block_number"`
 	BlockTimestamp  int64             `json:"block_timestamp"`
@@ -33,6 +85,31 @@ type Event struct {
 	Event           string            `json:"event"`
 	TransactionHash string            `json:"transaction_id"`
 	Result          map[string]string `json:"result"`
+	ResultType      map[string]string `json:"result_type"`
+	// Values are typed results decoded by the LogDecoder, read them via accessors like BigInt
+	Values map[string]interface{} `json:"-"`
+}
+
+// Log is a raw contract log, topics and data are hex encoded
+type Log struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+type TransactionInfo struct {
+	ID             string `json:"id"`
+	BlockNumber    uint64 `json:"blockNumber"`
+	BlockTimeStamp int64  `json:"blockTimeStamp"`
+	Log            []*Log `json:"log"`
+}
+
+type BlockNumRequest struct {
+	Num uint64 `json:"num"`
+}
+
+type TxIdRequest struct {
+	Value string `json:"value"`
 }
 
 type Events struct {
@@ -48,4 +125,17 @@ type Events struct {
 }
 
 type Block struct {
+	BlockID     string `json:"blockID"`
+	BlockHeader struct {
+		RawData struct {
+			Number     uint64 `json:"number"`
+			ParentHash string `json:"parentHash"`
+			Timestamp  int64  `json:"timestamp"`
+		} `json:"raw_data"`
+	} `json:"block_header"`
+}
+
+type BlockRequest struct {
+	IdOrNum string `json:"id_or_num"`
+	Detail  bool   `json:"detail"`
 }
@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"psm-monitor/net"
+)
+
+// discordMaxLength is the max length of the content of a discord message
+const discordMaxLength = 2000
+
+// DiscordNotifier posts messages to the webhook of discord, mrkdwn is translated to discord markdown
+type DiscordNotifier struct {
+	name    string
+	webhook string
+}
+
+type discordMessage struct {
+	Content string `json:"content"`
+}
+
+func (n *DiscordNotifier) Name() string {
+	return n.name
+}
+
+func (n *DiscordNotifier) Notify(msg *Message) error {
+	content := toMarkdown(headline(msg))
+	if runes := []rune(content); len(runes) > discordMaxLength {
+		content = string(runes[:discordMaxLength-3]) + "..."
+	}
+	// wait for the message to be created, so that the response is 200 with the message instead of 204
+	_, err := net.Post(n.webhook+"?wait=true", &discordMessage{Content: content}, nil)
+	return err
+}
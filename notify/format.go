@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// mrkdwnPattern matches links like <url|label>, inline code and emoji shortcodes of slack mrkdwn
+var mrkdwnPattern = regexp.MustCompile("<([^|<>]+)\\|([^<>]+)>|`([^`]*)`|:([a-z0-9_+-]+):")
+
+// emojis translates shortcodes used by monitors, custom emojis of token logos become token symbols
+var emojis = map[string]string{
+	"bangbang":           "‼️",
+	"warning":            "⚠️",
+	"rotating_light":     "🚨",
+	"white_check_mark":   "✅",
+	"zany_face":          "🤪",
+	"bricks":             "🧱",
+	"repeat":             "🔁",
+	"dollar":             "💵",
+	"curly_loop":         "➰",
+	"clown_face":         "🤡",
+	"clippy":             "📎",
+	"arrow_heading_up":   "⤴️",
+	"arrow_heading_down": "⤵️",
+	"usdtlogo":           "USDT",
+	"usdclogo":           "USDC",
+	"tusdlogo":           "TUSD",
+	"usdjlogo":           "USDJ",
+	"usdd":               "USDD",
+	"sunio":              "SUN",
+	"justlend":           "JustLend",
+	"jst":                "JST",
+}
+
+// translate rewrites links, inline code and emojis of the mrkdwn text, and escapes the rest,
+// unknown shortcodes like :04: of times are kept as is
+func translate(text string, link func(url, label string) string, code func(s string) string, escape func(s string) string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range mrkdwnPattern.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(escape(text[last:m[0]]))
+		switch {
+		case m[2] >= 0:
+			sb.WriteString(link(text[m[2]:m[3]], text[m[4]:m[5]]))
+		case m[6] >= 0:
+			sb.WriteString(code(text[m[6]:m[7]]))
+		default:
+			if emoji, ok := emojis[text[m[8]:m[9]]]; ok {
+				sb.WriteString(escape(emoji))
+			} else {
+				sb.WriteString(escape(text[m[0]:m[1]]))
+			}
+		}
+		last = m[1]
+	}
+	sb.WriteString(escape(text[last:]))
+	return sb.String()
+}
+
+func identity(s string) string {
+	return s
+}
+
+// toPlain translates mrkdwn to plain text, for mails and generic webhooks
+func toPlain(text string) string {
+	return translate(text, func(url, label string) string {
+		return label + " (" + url + ")"
+	}, identity, identity)
+}
+
+// toHTML translates mrkdwn to the html subset of telegram
+func toHTML(text string) string {
+	return translate(text, func(url, label string) string {
+		return "<a href=\"" + html.EscapeString(url) + "\">" + html.EscapeString(label) + "</a>"
+	}, func(s string) string {
+		return "<code>" + html.EscapeString(s) + "</code>"
+	}, html.EscapeString)
+}
+
+// toMarkdown translates mrkdwn to discord markdown
+func toMarkdown(text string) string {
+	return translate(text, func(url, label string) string {
+		return "[" + label + "](" + url + ")"
+	}, func(s string) string {
+		return "`" + s + "`"
+	}, identity)
+}
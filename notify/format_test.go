@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	text := ":usdd: [PSM] [01-02 15:04:05] :bangbang: Large SellGem, :usdtlogo: - `1,000` :arrow_heading_up:, " +
+		":clippy:<https://tronscan.io/#/transaction/abc|TxHash> a<b"
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"plain", toPlain(text), "USDD [PSM] [01-02 15:04:05] ‼️ Large SellGem, USDT - 1,000 ⤴️, " +
+			"📎TxHash (https://tronscan.io/#/transaction/abc) a<b"},
+		{"html", toHTML(text), "USDD [PSM] [01-02 15:04:05] ‼️ Large SellGem, USDT - <code>1,000</code> ⤴️, " +
+			"📎<a href=\"https://tronscan.io/#/transaction/abc\">TxHash</a> a&lt;b"},
+		{"markdown", toMarkdown(text), "USDD [PSM] [01-02 15:04:05] ‼️ Large SellGem, USDT - `1,000` ⤴️, " +
+			"📎[TxHash](https://tronscan.io/#/transaction/abc) a<b"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
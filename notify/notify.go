@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"psm-monitor/config"
+	"psm-monitor/misc"
+)
+
+type Severity string
+
+const (
+	Info     Severity = "info"
+	Warning  Severity = "warning"
+	Critical Severity = "critical"
+)
+
+// Message is a notification in slack mrkdwn, backends translate it to their own format
+type Message struct {
+	// Topic is like ":usdd: [PSM]", empty topic means the text is sent as is
+	Topic    string
+	Monitor  string
+	Severity Severity
+	Text     string
+	Time     time.Time
+}
+
+// Notifier is a backend messages are delivered to
+type Notifier interface {
+	Name() string
+	Notify(msg *Message) error
+}
+
+// maxSentMessages is the number of recently sent messages kept for looking up alerts afterwards
+const maxSentMessages = 1024
+
+var (
+	sentMessages []string
+	sentLock     sync.Mutex
+)
+
+func SendMsg(topic string, severity Severity, format string, a ...any) {
+	content := format
+	if len(a) != 0 {
+		content = fmt.Sprintf(format, a...)
+	}
+	_ = Send(&Message{Topic: topic, Severity: severity, Text: content})
+}
+
+// Send delivers the message to channels of matched routes, it fails only if no channel got the message
+func Send(msg *Message) error {
+	if len(msg.Monitor) == 0 {
+		msg.Monitor = MonitorOf(msg.Topic)
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	conf := config.Get()
+	delivered := false
+	var lastErr error
+	for _, notifier := range route(conf, msg) {
+		if err := notifier.Notify(msg); err != nil {
+			misc.Warn("Send message", fmt.Sprintf("channel=%s content=\"%s\" res=failed reason=\"%s\"", notifier.Name(), msg.Text, err.Error()))
+			lastErr = err
+			continue
+		}
+		misc.Info("Send message", fmt.Sprintf("channel=%s content=\"%s\" res=success", notifier.Name(), msg.Text))
+		delivered = true
+	}
+	if !delivered {
+		if lastErr == nil {
+			lastErr = errors.New("no channel routed")
+		}
+		return lastErr
+	}
+	recordSent(headline(msg))
+	return nil
+}
+
+// route returns notifiers of channels of the first route matching the monitor and severity of the message,
+// or the fee channel for fee reports and the default channels for others if no route matches
+func route(conf *config.Config, msg *Message) []Notifier {
+	var names []string
+	for _, r := range conf.Notify.Routes {
+		if matches(r.Monitors, msg.Monitor) && matches(r.Severities, string(msg.Severity)) {
+			names = r.Channels
+			break
+		}
+	}
+	// fee reports keep going to the fee webhook unless a route says otherwise
+	if names == nil && msg.Monitor == feeMonitor {
+		names = []string{"fee"}
+	}
+	if names == nil {
+		names = conf.Notify.DefaultChannels
+	}
+	if len(names) == 0 {
+		names = []string{"slack"}
+	}
+	channels := channelsOf(conf)
+	notifiers, seen := make([]Notifier, 0), make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		cc, ok := channels[name]
+		if !ok {
+			misc.Warn("notify.route", fmt.Sprintf("channel=%s reason=\"not declared\"", name))
+			continue
+		}
+		notifier, err := newNotifier(conf, cc)
+		if err != nil {
+			misc.Warn("notify.route", fmt.Sprintf("channel=%s reason=\"%s\"", name, err.Error()))
+			continue
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers
+}
+
+func matches(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelsOf returns declared channels keyed by name, with slack and fee implied by the webhooks
+func channelsOf(conf *config.Config) map[string]config.ChannelConfig {
+	channels := map[string]config.ChannelConfig{
+		"slack": {Name: "slack", Type: "slack", URL: conf.SlackWebhook},
+		"fee":   {Name: "fee", Type: "slack", URL: conf.FeeSlackWebhook},
+	}
+	for _, cc := range conf.Notify.Channels {
+		channels[cc.Name] = cc
+	}
+	return channels
+}
+
+func newNotifier(conf *config.Config, cc config.ChannelConfig) (Notifier, error) {
+	switch cc.Type {
+	case "slack":
+		return &SlackNotifier{name: cc.Name, webhook: cc.URL, mentions: conf.Notify.CriticalMentions}, nil
+	case "telegram":
+		return &TelegramNotifier{name: cc.Name, token: cc.Token, chatID: cc.ChatID}, nil
+	case "discord":
+		return &DiscordNotifier{name: cc.Name, webhook: cc.URL}, nil
+	case "webhook":
+		return &WebhookNotifier{name: cc.Name, url: cc.URL}, nil
+	case "smtp":
+		return &SMTPNotifier{name: cc.Name, host: cc.Host, port: cc.Port, username: cc.Username,
+			password: cc.Password, from: cc.From, to: cc.To}, nil
+	}
+	return nil, fmt.Errorf("unknown channel type %s", cc.Type)
+}
+
+// MonitorOf returns the monitor name in the topic, like PSM of ":usdd: [PSM]"
+func MonitorOf(topic string) string {
+	start, end := strings.LastIndex(topic, "["), strings.LastIndex(topic, "]")
+	if start < 0 || end < start {
+		return topic
+	}
+	return topic[start+1 : end]
+}
+
+// headline is the message text with its topic and time in slack mrkdwn, critical text is marked with :bangbang:
+func headline(msg *Message) string {
+	text := msg.Text
+	if msg.Severity == Critical {
+		text = ":bangbang: " + text
+	}
+	if len(msg.Topic) == 0 {
+		return text
+	}
+	return fmt.Sprintf("%s [%s] %s", msg.Topic, msg.Time.Format("01-02 15:04:05"), text)
+}
+
+// FindSent returns the recently sent messages which contain the keyword, e.g. a transaction hash
+func FindSent(keyword string) []string {
+	sentLock.Lock()
+	defer sentLock.Unlock()
+	found := make([]string, 0)
+	for _, text := range sentMessages {
+		if strings.Contains(text, keyword) {
+			found = append(found, text)
+		}
+	}
+	return found
+}
+
+func recordSent(text string) {
+	sentLock.Lock()
+	defer sentLock.Unlock()
+	sentMessages = append(sentMessages, text)
+	if len(sentMessages) > maxSentMessages {
+		sentMessages = sentMessages[len(sentMessages)-maxSentMessages:]
+	}
+}
+
+// feeMonitor is the monitor of fee reports, which go to the fee channel if no route matches
+const feeMonitor = "FEE"
+
+func ReportFee(message string) {
+	_ = Send(&Message{Monitor: feeMonitor, Severity: Info, Text: message})
+}
+
+func ReportPanic(topic string, err error) {
+	SendMsg(":zany_face: [APP]", Critical, "Panic happened, doing `%s`, reason `%s`", topic, err.Error())
+	// misc.Error("Panic happened", reason)
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"psm-monitor/config"
+)
+
+func TestRoute(t *testing.T) {
+	conf := &config.Config{SlackWebhook: "https://hooks.slack.com/a", FeeSlackWebhook: "https://hooks.slack.com/b"}
+	conf.Notify.Channels = []config.ChannelConfig{{Name: "oncall", Type: "telegram"}}
+	conf.Notify.Routes = []config.RouteConfig{
+		{Monitors: []string{"FEE"}, Channels: []string{"fee"}},
+		{Severities: []string{"critical"}, Channels: []string{"oncall", "slack"}},
+		{Monitors: []string{"PSM"}, Channels: []string{"slack"}},
+	}
+	tests := []struct {
+		msg  *Message
+		want []string
+	}{
+		{&Message{Monitor: "FEE", Severity: Info}, []string{"fee"}},
+		{&Message{Monitor: "PSM", Severity: Critical}, []string{"oncall", "slack"}},
+		{&Message{Monitor: "SUN", Severity: Info}, []string{"slack"}},
+	}
+	for _, tt := range tests {
+		notifiers := route(conf, tt.msg)
+		names := make([]string, len(notifiers))
+		for i, n := range notifiers {
+			names[i] = n.Name()
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s %s routed to %v, want %v", tt.msg.Monitor, tt.msg.Severity, names, tt.want)
+		}
+	}
+}
+
+func TestRouteFeeFallback(t *testing.T) {
+	conf := &config.Config{SlackWebhook: "https://hooks.slack.com/a", FeeSlackWebhook: "https://hooks.slack.com/b"}
+	conf.Notify.Routes = []config.RouteConfig{{Severities: []string{"critical"}, Channels: []string{"slack"}}}
+	for monitor, want := range map[string]string{"FEE": "fee", "PSM": "slack"} {
+		notifiers := route(conf, &Message{Monitor: monitor, Severity: Info})
+		if len(notifiers) != 1 || notifiers[0].Name() != want {
+			t.Errorf("%s routed to %d channels, want %s", monitor, len(notifiers), want)
+		}
+	}
+}
+
+func TestHeadline(t *testing.T) {
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)
+	msg := &Message{Topic: ":usdd: [PSM]", Severity: Critical, Text: "Fee changed", Time: at}
+	if got, want := headline(msg), ":usdd: [PSM] [01-02 15:04:05] :bangbang: Fee changed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	msg.Severity = Info
+	if got, want := headline(msg), ":usdd: [PSM] [01-02 15:04:05] Fee changed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitHTML(t *testing.T) {
+	text := "head `a<b`\n" + strings.Repeat("x", 8) + "\n" + strings.Repeat("y", 40)
+	chunks := splitHTML(text, 30)
+	want := []string{"head <code>a&lt;b</code>", "xxxxxxxx", strings.Repeat("y", 25) + "..."}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %q, want %q", chunks, want)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Fatalf("got %q, want %q", chunks, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+
+	"psm-monitor/net"
+)
+
+// SlackNotifier posts messages to the incoming webhook of slack, messages are already in slack mrkdwn
+type SlackNotifier struct {
+	name    string
+	webhook string
+	// ids of user groups mentioned by critical messages
+	mentions []string
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (n *SlackNotifier) Name() string {
+	return n.name
+}
+
+func (n *SlackNotifier) Notify(msg *Message) error {
+	text := headline(msg)
+	if msg.Severity == Critical && len(n.mentions) > 0 {
+		groups := make([]string, len(n.mentions))
+		for i, id := range n.mentions {
+			groups[i] = "<!subteam^" + id + ">"
+		}
+		text = strings.Join(groups, " ") + " " + text
+	}
+	_, err := net.Post(n.webhook, &slackMessage{Text: text}, checkIfResponseOk)
+	return err
+}
+
+func checkIfResponseOk(resBody []byte) error {
+	if strings.ContainsAny(string(resBody), "ok") {
+		return nil
+	}
+	return errors.New("Slack response need ok, but got " + string(resBody))
+}
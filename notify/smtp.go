@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subjectMaxLength is the max length of the message text shown in the mail subject
+const subjectMaxLength = 80
+
+// smtpTimeout bounds dialing and the whole conversation with the mail server,
+// so that an unreachable server cannot hang the monitor
+const smtpTimeout = 10 * time.Second
+
+// SMTPNotifier mails messages in plain text
+type SMTPNotifier struct {
+	name     string
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (n *SMTPNotifier) Name() string {
+	return n.name
+}
+
+func (n *SMTPNotifier) Notify(msg *Message) error {
+	text := toPlain(headline(msg))
+	subject := strings.Join(strings.Fields(toPlain(msg.Text)), " ")
+	if runes := []rune(subject); len(runes) > subjectMaxLength {
+		subject = string(runes[:subjectMaxLength]) + "..."
+	}
+	var mail strings.Builder
+	mail.WriteString(fmt.Sprintf("From: %s\r\n", n.from))
+	mail.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(n.to, ", ")))
+	mail.WriteString(fmt.Sprintf("Subject: [%s] %s: %s\r\n", msg.Monitor, msg.Severity, subject))
+	mail.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	mail.WriteString(text + "\r\n")
+	return n.send([]byte(mail.String()))
+}
+
+// send is smtp.SendMail with timeouts
+func (n *SMTPNotifier) send(mail []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(n.host, strconv.Itoa(n.port)), smtpTimeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if len(n.username) > 0 {
+		if err := c.Auth(smtp.PlainAuth("", n.username, n.password, n.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mail); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
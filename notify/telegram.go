@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"strings"
+
+	"psm-monitor/net"
+)
+
+// telegramMaxLength is the max length of the text of a telegram message
+const telegramMaxLength = 4096
+
+// TelegramNotifier sends messages via the bot api, mrkdwn is translated to telegram html
+type TelegramNotifier struct {
+	name   string
+	token  string
+	chatID string
+}
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+func (n *TelegramNotifier) Name() string {
+	return n.name
+}
+
+// Notify sends the message, long messages like multi-line reports are split at lines into several ones
+func (n *TelegramNotifier) Notify(msg *Message) error {
+	for _, text := range splitHTML(headline(msg), telegramMaxLength) {
+		if err := n.send(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *TelegramNotifier) send(text string) error {
+	_, err := net.Post("https://api.telegram.org/bot"+n.token+"/sendMessage", &telegramMessage{
+		ChatID:                n.chatID,
+		Text:                  text,
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}, func(resBody []byte) error {
+		var res struct {
+			Ok          bool   `json:"ok"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(resBody, &res); err != nil {
+			return err
+		}
+		if !res.Ok {
+			return errors.New("telegram response is not ok, " + res.Description)
+		}
+		return nil
+	})
+	return err
+}
+
+// splitHTML translates the mrkdwn text to html in chunks of whole lines no longer than max,
+// so that no tag is cut, a single line longer than max is truncated as plain text
+func splitHTML(text string, max int) []string {
+	chunks := make([]string, 0)
+	chunk := ""
+	for _, line := range strings.Split(text, "\n") {
+		h := toHTML(line)
+		if len([]rune(h)) > max {
+			plain := []rune(toPlain(line))
+			for l := len(plain); l > 0; l = l * 9 / 10 {
+				if h = html.EscapeString(string(plain[:l])) + "..."; len([]rune(h)) <= max {
+					break
+				}
+			}
+		}
+		if len(chunk) > 0 && len([]rune(chunk))+1+len([]rune(h)) > max {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		if len(chunk) > 0 {
+			chunk += "\n"
+		}
+		chunk += h
+	}
+	return append(chunks, chunk)
+}
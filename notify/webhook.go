@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"time"
+
+	"psm-monitor/net"
+)
+
+// WebhookNotifier posts messages as json to any url, like an incident service or an internal gateway
+type WebhookNotifier struct {
+	name string
+	url  string
+}
+
+type webhookMessage struct {
+	Topic    string    `json:"topic"`
+	Monitor  string    `json:"monitor"`
+	Severity Severity  `json:"severity"`
+	Text     string    `json:"text"`
+	Mrkdwn   string    `json:"mrkdwn"`
+	Time     time.Time `json:"time"`
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(msg *Message) error {
+	_, err := net.Post(n.url, &webhookMessage{
+		Topic:    msg.Topic,
+		Monitor:  msg.Monitor,
+		Severity: msg.Severity,
+		Text:     toPlain(msg.Text),
+		Mrkdwn:   msg.Text,
+		Time:     msg.Time,
+	}, nil)
+	return err
+}
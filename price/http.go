@@ -0,0 +1,25 @@
+package price
+
+import (
+	"fmt"
+
+	"psm-monitor/net"
+)
+
+// HTTPSource quotes prices from the TronLink price api
+type HTTPSource struct{}
+
+func NewHTTPSource() *HTTPSource {
+	return &HTTPSource{}
+}
+
+func (s *HTTPSource) Name() string {
+	return "http"
+}
+
+func (s *HTTPSource) Price(symbol string) (float64, error) {
+	if value := net.GetPrice(symbol); value > 0 {
+		return value, nil
+	}
+	return 0, fmt.Errorf("price: http quote of %s failed", symbol)
+}
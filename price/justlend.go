@@ -0,0 +1,78 @@
+package price
+
+import (
+	"math/big"
+	"sync"
+
+	"psm-monitor/abi"
+	"psm-monitor/misc"
+)
+
+var (
+	oracleMethod             = abi.MustMethod("oracle()", "address")
+	getUnderlyingPriceMethod = abi.MustMethod("getUnderlyingPrice(address)", "uint256")
+)
+
+// JToken is the market of an underlying token in JustLend
+type JToken struct {
+	Addr     string
+	Decimals uint8
+}
+
+// JustLendSource quotes underlying prices of JustLend markets from the price oracle of the comptroller
+type JustLendSource struct {
+	comptroller string
+	markets     map[string]JToken
+
+	lock   sync.Mutex
+	oracle string
+}
+
+// NewJustLendSource creates the source of the comptroller, markets are keyed by underlying symbol
+func NewJustLendSource(comptroller string, markets map[string]JToken) *JustLendSource {
+	return &JustLendSource{comptroller: comptroller, markets: markets}
+}
+
+func (s *JustLendSource) Name() string {
+	return "justlend"
+}
+
+func (s *JustLendSource) Price(symbol string) (float64, error) {
+	market, ok := s.markets[symbol]
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	oracle, err := s.getOracle()
+	if err != nil {
+		return 0, err
+	}
+	value, err := getUnderlyingPriceMethod.CallBigInt(oracle, market.Addr)
+	if err != nil {
+		return 0, err
+	}
+	// the oracle price is scaled by 1e(36 - underlying decimals)
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(value), new(big.Float).SetInt(misc.GetDec(36-market.Decimals))).Float64()
+	return f, nil
+}
+
+// getOracle queries the oracle of the comptroller once, it is rarely changed
+func (s *JustLendSource) getOracle() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.oracle) > 0 {
+		return s.oracle, nil
+	}
+	values, err := oracleMethod.Call(s.comptroller)
+	if err != nil {
+		return "", err
+	}
+	s.oracle = values[0].(string)
+	return s.oracle, nil
+}
+
+// ResetOracle forgets the queried oracle, it is called when the comptroller sets a new one
+func (s *JustLendSource) ResetOracle() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.oracle = ""
+}
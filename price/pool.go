@@ -0,0 +1,51 @@
+package price
+
+import (
+	"math/big"
+
+	"psm-monitor/abi"
+	"psm-monitor/misc"
+)
+
+var getDyMethod = abi.MustMethod("get_dy(int128,int128,uint256)", "uint256")
+
+// PoolSource quotes coins of a SUN stable pool against its base coin, like USDT,
+// whose price comes from other sources
+type PoolSource struct {
+	name  string
+	addr  string
+	coins []string
+	decs  []uint8
+	base  int
+}
+
+func NewPoolSource(name, addr string, coins []string, decs []uint8, base int) *PoolSource {
+	return &PoolSource{name: name, addr: addr, coins: coins, decs: decs, base: base}
+}
+
+func (s *PoolSource) Name() string {
+	return "sun:" + s.name
+}
+
+func (s *PoolSource) Price(symbol string) (float64, error) {
+	i := -1
+	for k, coin := range s.coins {
+		if coin == symbol && k != s.base {
+			i = k
+		}
+	}
+	if i < 0 {
+		return 0, ErrUnsupported
+	}
+	basePrice, err := Get(s.coins[s.base])
+	if err != nil {
+		return 0, err
+	}
+	// quote one whole coin, small enough to ignore the slippage
+	dy, err := getDyMethod.CallBigInt(s.addr, i, s.base, misc.GetDec(s.decs[i]))
+	if err != nil {
+		return 0, err
+	}
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(dy), new(big.Float).SetInt(misc.GetDec(s.decs[s.base]))).Float64()
+	return f * basePrice, nil
+}
@@ -0,0 +1,135 @@
+package price
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"psm-monitor/config"
+	"psm-monitor/misc"
+)
+
+var (
+	// ErrUnsupported is returned by sources which do not quote the token
+	ErrUnsupported = errors.New("price: token not supported")
+	// ErrStale is returned if no source quotes the token and the cached price is too old
+	ErrStale = errors.New("price: no fresh price")
+)
+
+// Source quotes USD prices of tokens by symbol
+type Source interface {
+	// Name identifies the source in config and logs, like "justlend" or "sun:USDD-2pool"
+	Name() string
+	// Price returns the USD price of one whole token
+	Price(symbol string) (float64, error)
+}
+
+type quote struct {
+	value  float64
+	source string
+	at     time.Time
+}
+
+var (
+	lock    sync.Mutex
+	sources []Source
+	quotes  = make(map[string]*quote)
+)
+
+// Register adds the source, a registered source with the same name is replaced
+func Register(src Source) {
+	lock.Lock()
+	defer lock.Unlock()
+	for i, s := range sources {
+		if s.Name() == src.Name() {
+			sources[i] = src
+			return
+		}
+	}
+	sources = append(sources, src)
+}
+
+// Get returns the USD price of the token, quotes are cached for the configured ttl,
+// the cached quote is used within max age if all sources fail
+func Get(symbol string) (float64, error) {
+	symbol = strings.ToUpper(symbol)
+	conf := config.Get().Price
+	lock.Lock()
+	cached, ok := quotes[symbol]
+	ordered := orderSources(conf.Sources)
+	lock.Unlock()
+	if ok && time.Since(cached.at) < time.Duration(conf.TTL)*time.Second {
+		return cached.value, nil
+	}
+
+	for _, src := range ordered {
+		value, err := src.Price(symbol)
+		if err == nil && value > 0 {
+			lock.Lock()
+			quotes[symbol] = &quote{value: value, source: src.Name(), at: time.Now()}
+			lock.Unlock()
+			return value, nil
+		}
+		if err != nil && !errors.Is(err, ErrUnsupported) {
+			misc.Debug("Price report", fmt.Sprintf("source=%s symbol=%s reason=\"%s\"", src.Name(), symbol, err.Error()))
+		}
+	}
+
+	if ok && time.Since(cached.at) < time.Duration(conf.MaxAge)*time.Second {
+		misc.Warn("Price report", fmt.Sprintf("symbol=%s use stale price %f of %s quoted at %s",
+			symbol, cached.value, cached.source, cached.at.Format("15:04:05")))
+		return cached.value, nil
+	}
+	return 0, fmt.Errorf("%w of %s", ErrStale, symbol)
+}
+
+// USD returns the USD value of the readable token amount, a configured stablecoin without price is valued at 1 USD
+// so that USD thresholds fail open during price outages, other tokens without price return the error
+func USD(symbol string, amount *big.Int) (float64, error) {
+	f, _ := new(big.Float).SetInt(amount).Float64()
+	return USDFloat(symbol, f)
+}
+
+// USDFloat is like USD but for fractional amounts
+func USDFloat(symbol string, amount float64) (float64, error) {
+	return usdOf(symbol, amount, config.Get().Price.Stablecoins)
+}
+
+func usdOf(symbol string, amount float64, stablecoins []string) (float64, error) {
+	p, err := Get(symbol)
+	if err == nil {
+		return p * amount, nil
+	}
+	for _, stablecoin := range stablecoins {
+		if strings.EqualFold(symbol, stablecoin) {
+			misc.Warn("Price report", fmt.Sprintf("action=\"value %s\" reason=\"%s\", value the stablecoin at 1 USD", symbol, err.Error()))
+			return amount, nil
+		}
+	}
+	misc.Warn("Price report", fmt.Sprintf("action=\"value %s\" reason=\"%s\"", symbol, err.Error()))
+	return 0, err
+}
+
+// orderSources sorts sources by the configured order, a configured name like "sun" matches all "sun:*" sources,
+// sources not configured are tried last in the order they are registered
+func orderSources(names []string) []Source {
+	ordered := make([]Source, 0, len(sources))
+	picked := make(map[string]bool)
+	for _, name := range names {
+		for _, src := range sources {
+			if !picked[src.Name()] && (src.Name() == name || strings.HasPrefix(src.Name(), name+":")) {
+				picked[src.Name()] = true
+				ordered = append(ordered, src)
+			}
+		}
+	}
+	for _, src := range sources {
+		if !picked[src.Name()] {
+			ordered = append(ordered, src)
+		}
+	}
+	return ordered
+}
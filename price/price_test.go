@@ -0,0 +1,75 @@
+package price
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeSource struct {
+	name   string
+	prices map[string]float64
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Price(symbol string) (float64, error) {
+	if value, ok := s.prices[symbol]; ok {
+		return value, nil
+	}
+	return 0, ErrUnsupported
+}
+
+func TestOrderSources(t *testing.T) {
+	sources = nil
+	Register(&fakeSource{name: "http"})
+	Register(&fakeSource{name: "sun:USDD-2pool"})
+	Register(&fakeSource{name: "justlend"})
+	Register(&fakeSource{name: "sun:TUSD-2pool"})
+
+	var got []string
+	for _, src := range orderSources([]string{"justlend", "sun"}) {
+		got = append(got, src.Name())
+	}
+	want := []string{"justlend", "sun:USDD-2pool", "sun:TUSD-2pool", "http"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	sources = nil
+	Register(&fakeSource{name: "a", prices: map[string]float64{"USDT": 1}})
+	Register(&fakeSource{name: "b", prices: map[string]float64{"USDT": 2, "TRX": 0.1}})
+
+	if value, err := Get("usdt"); err != nil || value != 1 {
+		t.Fatalf("unexpected price %f, %v", value, err)
+	}
+	if value, err := Get("TRX"); err != nil || value != 0.1 {
+		t.Fatalf("unexpected price %f, %v", value, err)
+	}
+	if _, err := Get("BTC"); !errors.Is(err, ErrStale) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestUSDFailsOpenForStablecoins(t *testing.T) {
+	sources = nil
+	Register(&fakeSource{name: "a", prices: map[string]float64{"TRX": 0.1}})
+
+	if value, err := usdOf("TRX", 100, nil); err != nil || value != 10 {
+		t.Fatalf("unexpected value %f, %v", value, err)
+	}
+	if value, err := usdOf("usdd", 2, []string{"USDD"}); err != nil || value != 2 {
+		t.Fatalf("unpriced stablecoin should be valued at 1 USD, got %f, %v", value, err)
+	}
+	if _, err := usdOf("BTC", 2, []string{"USDD"}); !errors.Is(err, ErrStale) {
+		t.Fatalf("unpriced volatile token should return the error, got %v", err)
+	}
+}
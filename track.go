@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"psm-monitor/config"
+	"psm-monitor/misc"
+	"psm-monitor/monitor"
+	"psm-monitor/net"
+	"psm-monitor/notify"
+)
+
+// trackedBlock is a recently fetched block, kept for reorg detection and delayed handling
+type trackedBlock struct {
+	number     uint64
+	hash       string
+	parentHash string
+	events     []*net.Event
+}
+
+// orphan is a transaction whose events have been handled in a block which got replaced by a reorg
+type orphan struct {
+	blockNumber uint64
+	// confirmations of the handlers which have already handled it
+	handled    map[uint64]bool
+	reincluded bool
+}
+
+var (
+	// trackedBlockNumber is the latest fetched block, handlers requiring
+	// confirmations lag behind it, see handledBlockNumber
+	trackedBlockNumber uint64
+	trackLock          sync.RWMutex
+
+	// confirmations => last block whose events have been handled by handlers requiring such confirmations
+	handledBlockNumber map[uint64]uint64
+	recentBlocks       map[uint64]*trackedBlock
+
+	// orphaned txs of the last reorg, they are corrected once the new chain reaches orphansSettleAt
+	orphans         map[string]*orphan
+	orphansSettleAt uint64
+	orphansReported bool
+
+	// replay state after restart, replayTo is zero when there is nothing to replay
+	replayFrom    uint64
+	replayTo      uint64
+	replaySkipped uint64
+)
+
+func initTracker() {
+	handledBlockNumber = make(map[uint64]uint64)
+	recentBlocks = make(map[uint64]*trackedBlock)
+	orphans = make(map[string]*orphan)
+
+	latestBlockNumber := net.BlockNumber()
+	maxCatchUp := config.Get().Track.MaxCatchUp
+	trackedBlockNumber = latestBlockNumber
+	levels := trackedEvent.Confirmations()
+	names := make([]string, len(levels))
+	for i, confirmations := range levels {
+		names[i] = cursorName(confirmations)
+	}
+	pruneCursors(names)
+	for i, confirmations := range levels {
+		handled := latestBlockNumber
+		if cursor, ok := loadCursor(cursorName(confirmations)); ok && (latestBlockNumber == 0 || cursor < latestBlockNumber) {
+			if latestBlockNumber > maxCatchUp && cursor < latestBlockNumber-maxCatchUp {
+				if skipped := latestBlockNumber - maxCatchUp - cursor; skipped > replaySkipped {
+					replaySkipped = skipped
+				}
+				cursor = latestBlockNumber - maxCatchUp
+			}
+			handled = cursor
+		}
+		handledBlockNumber[confirmations] = handled
+		if i == 0 || handled < trackedBlockNumber {
+			trackedBlockNumber = handled
+		}
+	}
+	if latestBlockNumber > trackedBlockNumber {
+		replayFrom, replayTo = trackedBlockNumber+1, latestBlockNumber
+		misc.Info("Track task report", fmt.Sprintf("resume from block %d, %d blocks to replay, %d blocks skipped",
+			trackedBlockNumber, replayTo-trackedBlockNumber, replaySkipped))
+	}
+}
+
+func track() {
+	if !trackLock.TryLock() {
+		// the previous tracking (usually a backfill) is still running, do not pile up
+		misc.Info("Track task report", "previous tracking is still running")
+		return
+	}
+	defer trackLock.Unlock()
+	latestBlockNumber := net.BlockNumber()
+	if latestBlockNumber == 0 {
+		return
+	}
+	if trackedBlockNumber == 0 {
+		// the node was unreachable while initializing, start from the latest block
+		trackedBlockNumber = latestBlockNumber
+		for confirmations := range handledBlockNumber {
+			handledBlockNumber[confirmations] = latestBlockNumber
+		}
+		return
+	}
+	reportLag(latestBlockNumber)
+	if trackedBlockNumber >= latestBlockNumber {
+		// current block has already been tracked
+		misc.Info("Track task report", fmt.Sprintf("block %d is already tracked", trackedBlockNumber))
+		return
+	}
+	batchSize := config.Get().Track.BackfillConcurrency * 8
+	if batchSize == 0 {
+		batchSize = 8
+	}
+	for trackedBlockNumber < latestBlockNumber {
+		to := trackedBlockNumber + batchSize
+		if to > latestBlockNumber {
+			to = latestBlockNumber
+		}
+		if !backfill(trackedBlockNumber+1, to) {
+			break
+		}
+		reportLag(latestBlockNumber)
+	}
+	reportReplayIfDone()
+}
+
+// trackBlock remembers the fetched block, then hands over events which got enough confirmations,
+// it returns false if the block cannot be tracked for now
+func trackBlock(f *fetchedBlock) bool {
+	blockNumber, block, events := f.number, f.block, f.events
+	if parent, ok := recentBlocks[blockNumber-1]; ok && parent.hash != block.BlockHeader.RawData.ParentHash {
+		return rollback(blockNumber - 1)
+	}
+
+	for _, event := range events {
+		if o, ok := orphans[event.TransactionHash]; ok {
+			o.reincluded = true
+		}
+	}
+	recentBlocks[blockNumber] = &trackedBlock{
+		number:     blockNumber,
+		hash:       block.BlockID,
+		parentHash: block.BlockHeader.RawData.ParentHash,
+		events:     events,
+	}
+	trackedBlockNumber = blockNumber
+	misc.Info("Track task report", fmt.Sprintf("block %d is fetched, has %d events", blockNumber, len(events)))
+
+	levels := trackedEvent.Confirmations()
+	pruneHandled(levels)
+	for _, confirmations := range levels {
+		handled, ok := handledBlockNumber[confirmations]
+		if !ok {
+			// subscribed at runtime, handle events from this block on
+			handled = blockNumber - 1
+		}
+		for handled+1+confirmations <= trackedBlockNumber {
+			handled += 1
+			if b, ok := recentBlocks[handled]; ok {
+				handleEvents(b.events, confirmations)
+			}
+		}
+		if prev, ok := handledBlockNumber[confirmations]; !ok || handled != prev {
+			handledBlockNumber[confirmations] = handled
+			saveCursor(cursorName(confirmations), handled)
+		}
+	}
+
+	settleOrphans()
+	pruneRecentBlocks()
+	return true
+}
+
+// pruneHandled forgets confirmations whose last subscription has been removed, together with their cursors,
+// so that they neither hold back settling orphans nor resume from a stale cursor once subscribed again
+func pruneHandled(levels []uint64) {
+	subscribed := make(map[uint64]bool)
+	for _, confirmations := range levels {
+		subscribed[confirmations] = true
+	}
+	for confirmations := range handledBlockNumber {
+		if !subscribed[confirmations] {
+			delete(handledBlockNumber, confirmations)
+			deleteCursor(cursorName(confirmations))
+			misc.Info("Track task report", fmt.Sprintf("confirmations %d have no subscription, cursor removed", confirmations))
+		}
+	}
+}
+
+// rollback finds the common ancestor of the stored chain and the canonical chain below the given block,
+// then drops all replaced blocks so that they will be fetched again in the following tracking
+func rollback(fromBlockNumber uint64) bool {
+	ancestor, found := fromBlockNumber, false
+	for ; ancestor > 0; ancestor-- {
+		stored, ok := recentBlocks[ancestor]
+		if !ok {
+			break
+		}
+		canonical, err := net.GetBlock(ancestor)
+		if err != nil {
+			misc.Warn("Track task report", fmt.Sprintf("block %d cannot be fetched, reason=\"%s\"", ancestor, err.Error()))
+			return false
+		}
+		if canonical.BlockID == stored.hash {
+			found = true
+			break
+		}
+	}
+	if found && ancestor == fromBlockNumber {
+		// the stored chain is still canonical, the node just served a stale block
+		return false
+	}
+	if !found {
+		misc.Warn("Track task report", fmt.Sprintf("reorg deeper than the remembered %d blocks", len(recentBlocks)))
+	}
+
+	for confirmations, handled := range handledBlockNumber {
+		if handled <= ancestor {
+			continue
+		}
+		for ; handled > ancestor; handled-- {
+			if b, ok := recentBlocks[handled]; ok {
+				for _, event := range b.events {
+					o, ok := orphans[event.TransactionHash]
+					if !ok {
+						o = &orphan{blockNumber: handled, handled: make(map[uint64]bool)}
+						orphans[event.TransactionHash] = o
+					}
+					o.handled[confirmations] = true
+				}
+			}
+		}
+		handledBlockNumber[confirmations] = handled
+		saveCursor(cursorName(confirmations), handled)
+	}
+	for blockNumber := ancestor + 1; blockNumber <= trackedBlockNumber; blockNumber++ {
+		delete(recentBlocks, blockNumber)
+	}
+	if trackedBlockNumber > orphansSettleAt {
+		orphansSettleAt = trackedBlockNumber
+	}
+	orphansReported = false
+	notify.SendMsg(":zany_face: [APP]", notify.Warning, "Chain reorg detected, blocks `%d` ~ `%d` are replaced", ancestor+1, trackedBlockNumber)
+	trackedBlockNumber = ancestor
+	return true
+}
+
+// settleOrphans corrects alerts of orphaned txs once the new chain has replaced all orphaned blocks,
+// and forgets them after handlers of all confirmations have passed the replaced range
+func settleOrphans() {
+	if len(orphans) == 0 || trackedBlockNumber < orphansSettleAt {
+		return
+	}
+	if !orphansReported {
+		orphansReported = true
+		for txHash, o := range orphans {
+			if o.reincluded {
+				continue
+			}
+			monitor.DiscardFlows(txHash)
+			alerts := notify.FindSent(txHash)
+			if len(alerts) > 0 {
+				notify.SendMsg(":zany_face: [APP]", notify.Warning, "Correction, tx in block `%d` is orphaned by chain reorg, `%d` alerts referencing it are void, %s",
+					o.blockNumber, len(alerts), misc.FormatTxUrl(txHash))
+			} else {
+				misc.Info("Track task report", fmt.Sprintf("tx %s in block %d is orphaned without alerts", txHash, o.blockNumber))
+			}
+		}
+	}
+	for _, handled := range handledBlockNumber {
+		if handled < orphansSettleAt {
+			return
+		}
+	}
+	orphans = make(map[string]*orphan)
+}
+
+func pruneRecentBlocks() {
+	window := config.Get().Track.ReorgWindow
+	for _, confirmations := range trackedEvent.Confirmations() {
+		if confirmations+1 > window {
+			window = confirmations + 1
+		}
+	}
+	for blockNumber := range recentBlocks {
+		if blockNumber+window <= trackedBlockNumber {
+			delete(recentBlocks, blockNumber)
+		}
+	}
+}
+
+func reportReplayIfDone() {
+	if replayTo == 0 || trackedBlockNumber < replayTo {
+		return
+	}
+	msg := fmt.Sprintf("Resumed from stored cursor, replayed `%d` blocks from `%d` ~ `%d`",
+		replayTo-replayFrom+1, replayFrom, replayTo)
+	if replaySkipped > 0 {
+		msg += fmt.Sprintf(", `%d` blocks skipped for exceeding max catch-up", replaySkipped)
+	}
+	notify.SendMsg(":zany_face: [APP]", notify.Info, msg)
+	replayTo = 0
+}
+
+func handleEvents(events []*net.Event, confirmations uint64) {
+	for _, event := range events {
+		if o, ok := orphans[event.TransactionHash]; ok && o.handled[confirmations] {
+			// already handled before the reorg, skip it to avoid duplicated alerts
+			continue
+		}
+		trackedEvent.Dispatch(event, confirmations)
+	}
+}